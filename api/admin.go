@@ -0,0 +1,209 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"santiagotorres.me/user-service/logger"
+	"santiagotorres.me/user-service/models"
+	"santiagotorres.me/user-service/repositories"
+	"santiagotorres.me/user-service/services"
+)
+
+func (appState *AppState) SetUpAdminRoutes(r *gin.Engine) {
+	adminRouter := r.Group("/admin/users", appState.CheckJWT())
+
+	{
+		adminRouter.GET("", appState.RequirePermission(models.UsersReadPermission), appState.AdminListUsers)
+		adminRouter.GET("/:id", appState.RequirePermission(models.UsersReadPermission), appState.AdminGetUser)
+		adminRouter.POST("/:id/disable", appState.RequirePermission(models.UsersWritePermission), appState.AdminDisableUser)
+		adminRouter.POST("/:id/enable", appState.RequirePermission(models.UsersWritePermission), appState.AdminEnableUser)
+		adminRouter.POST("/:id/force-password-reset", appState.RequirePermission(models.UsersWritePermission), appState.AdminForcePasswordReset)
+		adminRouter.POST("/:id/reset-mfa", appState.RequirePermission(models.UsersWritePermission), appState.AdminResetMFA)
+		adminRouter.POST("/:id/revoke-sessions", appState.RequirePermission(models.UsersWritePermission), appState.AdminRevokeSessions)
+	}
+}
+
+// userIDParam parses the :id path parameter, answering 400 when it is not a UUID.
+func userIDParam(context *gin.Context) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(context.Param("id"))
+
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return uuid.Nil, false
+	}
+
+	return userID, true
+}
+
+// auditAdminAction logs who performed an admin action on which user.
+func auditAdminAction(context *gin.Context, action string, userID uuid.UUID) {
+	logger.Logger.InfoContext(context.Request.Context(), "Admin action", "action", action, "actorId", MustGetClaims(context).UserID, "userId", userID)
+}
+
+// respondAdminError maps repository errors of the admin operations to responses.
+func respondAdminError(context *gin.Context, operation string, err error) {
+	if errors.Is(err, repositories.ErrUserNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	logger.Logger.ErrorContext(context.Request.Context(), "Error during admin operation", "operation", operation, "err", err.Error())
+	context.JSON(http.StatusInternalServerError, gin.H{
+		"error": "An unexpected error occurred",
+	})
+}
+
+func (appState *AppState) AdminListUsers(context *gin.Context) {
+	var req struct {
+		Query    string `form:"q"`
+		Page     int    `form:"page" binding:"omitempty,min=1"`
+		PageSize int    `form:"page_size" binding:"omitempty,min=1"`
+	}
+
+	if err := context.ShouldBindQuery(&req); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Page == 0 {
+		req.Page = 1
+	}
+
+	if req.PageSize == 0 {
+		req.PageSize = 20
+	}
+
+	req.PageSize = min(req.PageSize, repositories.MaxUserPageSize)
+
+	users, total, err := repositories.ListUsers(req.Query, req.Page, req.PageSize, appState.Db)
+
+	if err != nil {
+		respondAdminError(context, "list users", err)
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{
+		"users":     users,
+		"page":      req.Page,
+		"page_size": req.PageSize,
+		"total":     total,
+	})
+}
+
+func (appState *AppState) AdminGetUser(context *gin.Context) {
+	userID, ok := userIDParam(context)
+	if !ok {
+		return
+	}
+
+	user, err := repositories.GetUserDetail(userID, appState.Db)
+
+	if err != nil {
+		respondAdminError(context, "get user", err)
+		return
+	}
+
+	context.JSON(http.StatusOK, user)
+}
+
+func (appState *AppState) AdminDisableUser(context *gin.Context) {
+	userID, ok := userIDParam(context)
+	if !ok {
+		return
+	}
+
+	// Admins cannot lock themselves out
+	if userID == MustGetClaims(context).UserID {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "You cannot disable your own account"})
+		return
+	}
+
+	if err := repositories.SetUserDisabled(userID, true, appState.Db); err != nil {
+		respondAdminError(context, "disable user", err)
+		return
+	}
+
+	auditAdminAction(context, "disable", userID)
+	context.Status(http.StatusNoContent)
+}
+
+func (appState *AppState) AdminEnableUser(context *gin.Context) {
+	userID, ok := userIDParam(context)
+	if !ok {
+		return
+	}
+
+	if err := repositories.SetUserDisabled(userID, false, appState.Db); err != nil {
+		respondAdminError(context, "enable user", err)
+		return
+	}
+
+	auditAdminAction(context, "enable", userID)
+	context.Status(http.StatusNoContent)
+}
+
+// AdminForcePasswordReset signs the user out everywhere and emails them a password reset link.
+// They cannot log in again until the password is reset.
+func (appState *AppState) AdminForcePasswordReset(context *gin.Context) {
+	userID, ok := userIDParam(context)
+	if !ok {
+		return
+	}
+
+	user, resetToken, err := repositories.ForcePasswordReset(userID, appState.Db)
+
+	if err != nil {
+		respondAdminError(context, "force password reset", err)
+		return
+	}
+
+	auditAdminAction(context, "force-password-reset", userID)
+
+	go appState.sendForcedPasswordReset(*user, resetToken)
+
+	context.Status(http.StatusNoContent)
+}
+
+func (appState *AppState) sendForcedPasswordReset(user models.User, resetToken string) {
+	ctx := context.Background()
+
+	if err := services.SendPasswordResetEmail(ctx, appState.Mailer, &user, resetToken, appState.Settings.PasswordResetURL, repositories.PasswordResetTokenTTL); err != nil {
+		logger.Logger.ErrorContext(ctx, "Error sending password reset email", "err", err.Error(), "userId", user.UserID)
+	}
+}
+
+func (appState *AppState) AdminResetMFA(context *gin.Context) {
+	userID, ok := userIDParam(context)
+	if !ok {
+		return
+	}
+
+	if err := repositories.ResetMFA(userID, appState.Db); err != nil {
+		respondAdminError(context, "reset MFA", err)
+		return
+	}
+
+	auditAdminAction(context, "reset-mfa", userID)
+	context.Status(http.StatusNoContent)
+}
+
+func (appState *AppState) AdminRevokeSessions(context *gin.Context) {
+	userID, ok := userIDParam(context)
+	if !ok {
+		return
+	}
+
+	revoked, err := repositories.RevokeAllUserSessions(userID, appState.Db)
+
+	if err != nil {
+		respondAdminError(context, "revoke sessions", err)
+		return
+	}
+
+	auditAdminAction(context, "revoke-sessions", userID)
+	context.JSON(http.StatusOK, gin.H{"revokedSessions": revoked})
+}
@@ -1,13 +1,22 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
 	"errors"
+	"image/png"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"santiagotorres.me/user-service/logger"
 	"santiagotorres.me/user-service/models"
 	"santiagotorres.me/user-service/repositories"
+	"santiagotorres.me/user-service/services"
 	"santiagotorres.me/user-service/utils"
 )
 
@@ -15,31 +24,31 @@ func (appState *AppState) SetUpAuthRoutes(r *gin.Engine) {
 	authRouter := r.Group("/auth")
 
 	{
-		authRouter.POST("/signup", appState.SignUp)
-		authRouter.POST("/login", appState.Login)
+		authRouter.POST("/signup", appState.RateLimit("signup", appState.RateLimits.Signup, RateLimitByIP), appState.SignUp)
+		authRouter.POST("/login", appState.RateLimit("login", appState.RateLimits.Login, RateLimitByIP), appState.Login)
 		authRouter.POST("/register-totp", appState.CheckJWT(), appState.RegisterTOTP)
-		authRouter.POST("/refresh", func(context *gin.Context) {
-
-		})
-		authRouter.POST("/logout", func(context *gin.Context) {
-
-		})
-		authRouter.POST("/forgot-password", func(context *gin.Context) {
-
-		})
-		authRouter.POST("/reset-password", func(context *gin.Context) {
-
-		})
-		authRouter.POST("/verify", func(context *gin.Context) {
-
-		})
+		authRouter.POST("/totp/confirm", appState.CheckJWT(), appState.ConfirmTOTP)
+		authRouter.POST("/totp/verify", appState.RateLimit("totp-verify", appState.RateLimits.TOTPVerify, RateLimitByIP), appState.VerifyTOTP)
+		authRouter.POST("/totp/recovery-codes", appState.CheckJWT(), appState.RegenerateRecoveryCodes)
+		authRouter.DELETE("/totp", appState.CheckJWT(), appState.RateLimit("totp-disable", appState.RateLimits.TOTPDisable, RateLimitByUser), appState.DisableTOTP)
+		authRouter.POST("/refresh", appState.Refresh)
+		authRouter.POST("/logout", appState.CheckJWT(), appState.Logout)
+		authRouter.POST("/forgot-password", appState.RateLimit("forgot-password", appState.RateLimits.ForgotPassword, RateLimitByIP), appState.ForgotPassword)
+		authRouter.POST("/reset-password", appState.RateLimit("reset-password", appState.RateLimits.ResetPassword, RateLimitByIP), appState.ResetPassword)
+		authRouter.POST("/verify", appState.VerifyEmail)
+		authRouter.POST("/verify/resend", appState.RateLimit("resend-verification", appState.RateLimits.ResendVerification, RateLimitByIP), appState.ResendVerification)
 	}
 }
 
 func (appState *AppState) SignUp(c *gin.Context) {
-	var user models.User
+	// Bound separately from models.User so a request cannot set verification state or associations
+	var req struct {
+		Name     string `json:"name"`
+		Email    string `json:"email" binding:"required,email"`
+		Password string `json:"password" binding:"required"`
+	}
 
-	if err := c.ShouldBindJSON(&user); err != nil {
+	if err := c.ShouldBindJSON(&req); err != nil {
 		logger.Logger.ErrorContext(
 			c.Request.Context(),
 			"Error deserializing user",
@@ -51,9 +60,24 @@ func (appState *AppState) SignUp(c *gin.Context) {
 		return
 	}
 
-	userId, err := repositories.CreateUser(&user, appState.Db)
+	user := models.User{
+		Name:     req.Name,
+		Email:    req.Email,
+		Password: req.Password,
+	}
+
+	userId, err := repositories.CreateUser(&user, appState.PasswordPolicy, appState.Db)
 
 	if err != nil {
+		var validationErr *repositories.ValidationError
+		if errors.As(err, &validationErr) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":  "Validation failed",
+				"fields": validationErr.Fields,
+			})
+			return
+		}
+
 		// Check for specific error types using errors.Is
 		if errors.Is(err, repositories.ErrUserAlreadyExists) {
 			c.JSON(http.StatusConflict, gin.H{
@@ -89,9 +113,96 @@ func (appState *AppState) SignUp(c *gin.Context) {
 		return
 	}
 
+	go appState.sendEmailVerification(user)
+
 	c.JSON(http.StatusCreated, gin.H{"userID": userId})
 }
 
+func (appState *AppState) sendEmailVerification(user models.User) {
+	ctx := context.Background()
+
+	verificationToken, err := repositories.CreateEmailVerificationToken(&user, appState.Db)
+
+	if err != nil {
+		if errors.Is(err, repositories.ErrVerificationCooldown) || errors.Is(err, repositories.ErrEmailAlreadyVerified) {
+			logger.Logger.InfoContext(ctx, "Verification email not sent", "reason", err.Error(), "userId", user.UserID)
+			return
+		}
+		logger.Logger.ErrorContext(ctx, "Error creating email verification token", "err", err.Error())
+		return
+	}
+
+	if err := services.SendEmailVerificationEmail(ctx, appState.Mailer, &user, verificationToken, appState.Settings.EmailVerificationURL, repositories.EmailVerificationTokenTTL); err != nil {
+		logger.Logger.ErrorContext(ctx, "Error sending email verification email", "err", err.Error(), "userId", user.UserID)
+	}
+}
+
+func (appState *AppState) VerifyEmail(context *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := context.ShouldBindJSON(&req); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := repositories.VerifyEmail(req.Token, appState.Db); err != nil {
+		if errors.Is(err, repositories.ErrInvalidToken) {
+			context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+			return
+		}
+
+		logger.Logger.ErrorContext(context.Request.Context(), "Unexpected error during email verification", "err", err.Error())
+		context.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An unexpected error occurred",
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"emailVerified": true})
+}
+
+func (appState *AppState) ResendVerification(context *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := context.ShouldBindJSON(&req); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Same as forgot-password, the outcome is not revealed so the endpoint cannot be used to probe for accounts.
+	// The resend cooldown is enforced in the background.
+	go appState.resendEmailVerification(req.Email)
+
+	context.JSON(http.StatusAccepted, gin.H{
+		"message": "If an unverified account exists for this email, a verification link has been sent",
+	})
+}
+
+func (appState *AppState) resendEmailVerification(email string) {
+	ctx := context.Background()
+
+	user, verificationToken, err := repositories.ResendEmailVerification(email, appState.Db)
+
+	if err != nil {
+		if errors.Is(err, repositories.ErrVerificationCooldown) {
+			logger.Logger.InfoContext(ctx, "Verification email resend throttled", "email", email)
+			return
+		}
+		if !errors.Is(err, repositories.ErrUserNotFound) && !errors.Is(err, repositories.ErrEmailAlreadyVerified) {
+			logger.Logger.ErrorContext(ctx, "Error creating email verification token", "err", err.Error())
+		}
+		return
+	}
+
+	if err := services.SendEmailVerificationEmail(ctx, appState.Mailer, user, verificationToken, appState.Settings.EmailVerificationURL, repositories.EmailVerificationTokenTTL); err != nil {
+		logger.Logger.ErrorContext(ctx, "Error sending email verification email", "err", err.Error(), "userId", user.UserID)
+	}
+}
+
 func (appState *AppState) Login(context *gin.Context) {
 	var req struct {
 		Email    string `json:"email" binding:"required,email"`
@@ -105,9 +216,18 @@ func (appState *AppState) Login(context *gin.Context) {
 
 	deviceInfo := utils.ExtractDeviceInfo(context)
 
-	tokens, err := repositories.LoginUser(req.Email, req.Password, &deviceInfo, appState.Db)
+	tokens, err := repositories.LoginUser(req.Email, req.Password, appState.Settings.RequireVerifiedEmail, &deviceInfo, appState.TokenService, appState.Db)
 
 	if err != nil {
+		var lockoutErr *repositories.LockoutError
+		if errors.As(err, &lockoutErr) {
+			setRetryAfter(context, lockoutErr.RetryAfter)
+			context.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "Too many failed attempts, try again later",
+			})
+			return
+		}
+
 		// Check for specific error types using errors.Is
 		if errors.Is(err, repositories.ErrInvalidCredentials) {
 			context.JSON(http.StatusUnauthorized, gin.H{
@@ -116,6 +236,27 @@ func (appState *AppState) Login(context *gin.Context) {
 			return
 		}
 
+		if errors.Is(err, repositories.ErrEmailNotVerified) {
+			context.JSON(http.StatusForbidden, gin.H{
+				"error": "Email address not verified",
+			})
+			return
+		}
+
+		if errors.Is(err, repositories.ErrAccountDisabled) {
+			context.JSON(http.StatusForbidden, gin.H{
+				"error": "Account disabled",
+			})
+			return
+		}
+
+		if errors.Is(err, repositories.ErrPasswordResetRequired) {
+			context.JSON(http.StatusForbidden, gin.H{
+				"error": "Password reset required, check your email for a reset link",
+			})
+			return
+		}
+
 		// Check for repository errors by type
 		var repoErr *repositories.RepositoryError
 		if errors.As(err, &repoErr) {
@@ -146,6 +287,457 @@ func (appState *AppState) Login(context *gin.Context) {
 	context.JSON(http.StatusOK, tokens)
 }
 
+func (appState *AppState) Refresh(context *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := context.ShouldBindJSON(&req); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, claims, err := appState.TokenService.ValidateToken(req.RefreshToken)
+
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			context.JSON(http.StatusUnauthorized, gin.H{"error": "token expired"})
+			return
+		}
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+
+	tokens, err := repositories.RefreshToken(token.Raw, claims, appState.TokenService, appState.Db)
+
+	if err != nil {
+		if errors.Is(err, repositories.ErrInvalidToken) || errors.Is(err, repositories.ErrUserNotFound) {
+			context.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			return
+		}
+
+		if errors.Is(err, repositories.ErrSessionRevoked) || errors.Is(err, repositories.ErrRefreshTokenReused) {
+			context.JSON(http.StatusUnauthorized, gin.H{"error": "token revoked"})
+			return
+		}
+
+		var repoErr *repositories.RepositoryError
+		if errors.As(err, &repoErr) {
+			switch repoErr.Code {
+			case repositories.ErrCodeDatabaseError:
+				logger.Logger.ErrorContext(context.Request.Context(), "Database error during refresh", "err", err.Error())
+				context.JSON(http.StatusInternalServerError, gin.H{
+					"error": "An error occurred during token refresh",
+				})
+				return
+			case repositories.ErrCodeTokenGenerationError:
+				logger.Logger.ErrorContext(context.Request.Context(), "Token generation error", "err", err.Error())
+				context.JSON(http.StatusInternalServerError, gin.H{
+					"error": "Failed to generate authentication token",
+				})
+				return
+			}
+		}
+
+		// Generic error fallback
+		logger.Logger.ErrorContext(context.Request.Context(), "Unexpected error during refresh", "err", err.Error())
+		context.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An unexpected error occurred",
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, tokens)
+}
+
+func (appState *AppState) Logout(context *gin.Context) {
+	var query struct {
+		All         bool `form:"all"`
+		KeepCurrent bool `form:"keep_current"`
+	}
+
+	if err := context.ShouldBindQuery(&query); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userSession := MustGetUserSession(context)
+
+	revoked, err := repositories.LogOutSession(userSession, query.All, query.KeepCurrent, appState.Db)
+
+	if err != nil {
+		logger.Logger.ErrorContext(context.Request.Context(), "Error during logout", "err", err.Error())
+		context.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred during logout",
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"revokedSessions": revoked})
+}
+
+func (appState *AppState) ForgotPassword(context *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := context.ShouldBindJSON(&req); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The token is created and sent in the background so the response, and its timing,
+	// does not reveal whether an account exists for the email
+	go appState.sendPasswordReset(req.Email)
+
+	context.JSON(http.StatusAccepted, gin.H{
+		"message": "If an account exists for this email, a password reset link has been sent",
+	})
+}
+
+func (appState *AppState) sendPasswordReset(email string) {
+	ctx := context.Background()
+
+	user, resetToken, err := repositories.ForgotPassword(email, appState.Db)
+
+	if err != nil {
+		if !errors.Is(err, repositories.ErrUserNotFound) {
+			logger.Logger.ErrorContext(ctx, "Error creating password reset token", "err", err.Error())
+		}
+		return
+	}
+
+	if err := services.SendPasswordResetEmail(ctx, appState.Mailer, user, resetToken, appState.Settings.PasswordResetURL, repositories.PasswordResetTokenTTL); err != nil {
+		logger.Logger.ErrorContext(ctx, "Error sending password reset email", "err", err.Error(), "userId", user.UserID)
+	}
+}
+
+func (appState *AppState) ResetPassword(context *gin.Context) {
+	var req struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+
+	if err := context.ShouldBindJSON(&req); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := repositories.ResetPassword(req.Token, req.Password, appState.PasswordPolicy, appState.Db); err != nil {
+		if errors.Is(err, repositories.ErrInvalidToken) {
+			context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+			return
+		}
+
+		var validationErr *repositories.ValidationError
+		if errors.As(err, &validationErr) {
+			context.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":  "Validation failed",
+				"fields": validationErr.Fields,
+			})
+			return
+		}
+
+		var repoErr *repositories.RepositoryError
+		if errors.As(err, &repoErr) && repoErr.Code == repositories.ErrCodeHashingError {
+			logger.Logger.ErrorContext(context.Request.Context(), "Password hashing error", "err", err.Error())
+			context.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to process password",
+			})
+			return
+		}
+
+		logger.Logger.ErrorContext(context.Request.Context(), "Unexpected error during password reset", "err", err.Error())
+		context.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An unexpected error occurred",
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
+
 func (appState *AppState) RegisterTOTP(context *gin.Context) {
-	// Implement TOTP registration logic here
+	claims := MustGetClaims(context)
+
+	totpKey, err := repositories.SetUpTOTP(claims.UserID, claims.Email, appState.Settings.TOTPIssuer, appState.EncryptorManager, appState.Db)
+
+	if err != nil {
+		if errors.Is(err, repositories.ErrTOTPAlreadyEnabled) {
+			context.JSON(http.StatusConflict, gin.H{"error": "TOTP is already enabled"})
+			return
+		}
+
+		logger.Logger.ErrorContext(context.Request.Context(), "Error setting up TOTP", "err", err.Error())
+		context.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to set up TOTP",
+		})
+		return
+	}
+
+	qrImage, err := totpKey.Image(256, 256)
+
+	if err != nil {
+		logger.Logger.ErrorContext(context.Request.Context(), "Error generating TOTP QR code", "err", err.Error())
+		context.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to set up TOTP",
+		})
+		return
+	}
+
+	var qrPNG bytes.Buffer
+	if err := png.Encode(&qrPNG, qrImage); err != nil {
+		logger.Logger.ErrorContext(context.Request.Context(), "Error encoding TOTP QR code", "err", err.Error())
+		context.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to set up TOTP",
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{
+		"otpauthUrl": totpKey.URL(),
+		"secret":     totpKey.Secret(),
+		"qrCode":     "data:image/png;base64," + base64.StdEncoding.EncodeToString(qrPNG.Bytes()),
+	})
+}
+
+func (appState *AppState) ConfirmTOTP(context *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required,len=6,numeric"`
+	}
+
+	if err := context.ShouldBindJSON(&req); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims := MustGetClaims(context)
+
+	deviceInfo := utils.ExtractDeviceInfo(context)
+
+	recoveryCodes, err := repositories.ConfirmTOTP(claims.UserID, claims.Email, req.Code, &deviceInfo, appState.EncryptorManager, appState.Db)
+
+	if err != nil {
+		var lockoutErr *repositories.LockoutError
+		if errors.As(err, &lockoutErr) {
+			setRetryAfter(context, lockoutErr.RetryAfter)
+			context.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "Too many failed attempts, try again later",
+			})
+			return
+		}
+
+		if errors.Is(err, repositories.ErrTOTPNotFound) {
+			context.JSON(http.StatusNotFound, gin.H{"error": "No pending TOTP enrollment"})
+			return
+		}
+
+		if errors.Is(err, repositories.ErrInvalidTOTPCode) {
+			context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid TOTP code"})
+			return
+		}
+
+		logger.Logger.ErrorContext(context.Request.Context(), "Error confirming TOTP", "err", err.Error())
+		context.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to confirm TOTP",
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{
+		"totpEnabled":   true,
+		"recoveryCodes": recoveryCodes,
+	})
+}
+
+func (appState *AppState) RegenerateRecoveryCodes(context *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required,len=6,numeric"`
+	}
+
+	if err := context.ShouldBindJSON(&req); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims := MustGetClaims(context)
+
+	deviceInfo := utils.ExtractDeviceInfo(context)
+
+	recoveryCodes, err := repositories.RegenerateRecoveryCodes(claims.UserID, claims.Email, req.Code, &deviceInfo, appState.EncryptorManager, appState.Db)
+
+	if err != nil {
+		var lockoutErr *repositories.LockoutError
+		if errors.As(err, &lockoutErr) {
+			setRetryAfter(context, lockoutErr.RetryAfter)
+			context.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "Too many failed attempts, try again later",
+			})
+			return
+		}
+
+		if errors.Is(err, repositories.ErrTOTPNotFound) {
+			context.JSON(http.StatusNotFound, gin.H{"error": "TOTP is not enabled"})
+			return
+		}
+
+		if errors.Is(err, repositories.ErrInvalidTOTPCode) {
+			context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid TOTP code"})
+			return
+		}
+
+		logger.Logger.ErrorContext(context.Request.Context(), "Error regenerating recovery codes", "err", err.Error())
+		context.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to regenerate recovery codes",
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"recoveryCodes": recoveryCodes})
+}
+
+func (appState *AppState) DisableTOTP(context *gin.Context) {
+	var req struct {
+		Password     string `json:"password" binding:"required"`
+		Code         string `json:"code" binding:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+		RecoveryCode string `json:"recovery_code" binding:"required_without=Code"`
+	}
+
+	if err := context.ShouldBindJSON(&req); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims := MustGetClaims(context)
+
+	deviceInfo := utils.ExtractDeviceInfo(context)
+
+	err := repositories.DisableTOTP(claims.UserID, req.Password, req.Code, req.RecoveryCode, &deviceInfo, appState.EncryptorManager, appState.Db)
+
+	if err != nil {
+		var lockoutErr *repositories.LockoutError
+		if errors.As(err, &lockoutErr) {
+			setRetryAfter(context, lockoutErr.RetryAfter)
+			context.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "Too many failed attempts, try again later",
+			})
+			return
+		}
+
+		if errors.Is(err, repositories.ErrInvalidCredentials) {
+			context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+			return
+		}
+
+		if errors.Is(err, repositories.ErrTOTPNotFound) || errors.Is(err, repositories.ErrUserNotFound) {
+			context.JSON(http.StatusNotFound, gin.H{"error": "TOTP is not enabled"})
+			return
+		}
+
+		if errors.Is(err, repositories.ErrInvalidTOTPCode) {
+			context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid TOTP code"})
+			return
+		}
+
+		if errors.Is(err, repositories.ErrInvalidRecoveryCode) {
+			context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid recovery code"})
+			return
+		}
+
+		logger.Logger.ErrorContext(context.Request.Context(), "Error disabling TOTP", "err", err.Error())
+		context.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to disable TOTP",
+		})
+		return
+	}
+
+	context.Status(http.StatusNoContent)
+}
+
+func (appState *AppState) VerifyTOTP(context *gin.Context) {
+	var req struct {
+		TempToken    string `json:"temp_token" binding:"required"`
+		Code         string `json:"code" binding:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+		RecoveryCode string `json:"recovery_code" binding:"required_without=Code"`
+	}
+
+	if err := context.ShouldBindJSON(&req); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, claims, err := appState.TokenService.ValidateToken(req.TempToken)
+
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			context.JSON(http.StatusUnauthorized, gin.H{"error": "token expired"})
+			return
+		}
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+
+	deviceInfo := utils.ExtractDeviceInfo(context)
+
+	tokens, err := repositories.VerifyTOTP(claims, req.Code, req.RecoveryCode, &deviceInfo, appState.EncryptorManager, appState.TokenService, appState.Db)
+
+	if err != nil {
+		var lockoutErr *repositories.LockoutError
+		if errors.As(err, &lockoutErr) {
+			setRetryAfter(context, lockoutErr.RetryAfter)
+			context.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "Too many failed attempts, try again later",
+			})
+			return
+		}
+
+		if errors.Is(err, repositories.ErrInvalidToken) || errors.Is(err, repositories.ErrUserNotFound) || errors.Is(err, repositories.ErrTOTPNotFound) {
+			context.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			return
+		}
+
+		if errors.Is(err, repositories.ErrAccountDisabled) {
+			context.JSON(http.StatusForbidden, gin.H{"error": "Account disabled"})
+			return
+		}
+
+		if errors.Is(err, repositories.ErrPasswordResetRequired) {
+			context.JSON(http.StatusForbidden, gin.H{"error": "Password reset required, check your email for a reset link"})
+			return
+		}
+
+		if errors.Is(err, repositories.ErrInvalidTOTPCode) {
+			context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid TOTP code"})
+			return
+		}
+
+		if errors.Is(err, repositories.ErrInvalidRecoveryCode) {
+			context.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid recovery code"})
+			return
+		}
+
+		var repoErr *repositories.RepositoryError
+		if errors.As(err, &repoErr) && repoErr.Code == repositories.ErrCodeTokenGenerationError {
+			logger.Logger.ErrorContext(context.Request.Context(), "Token generation error", "err", err.Error())
+			context.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to generate authentication token",
+			})
+			return
+		}
+
+		// Generic error fallback
+		logger.Logger.ErrorContext(context.Request.Context(), "Unexpected error during TOTP verification", "err", err.Error())
+		context.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An unexpected error occurred",
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, tokens)
+}
+
+// setRetryAfter tells the client how many seconds to wait before retrying.
+func setRetryAfter(context *gin.Context, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	context.Header("Retry-After", strconv.Itoa(max(seconds, 1)))
 }
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"santiagotorres.me/user-service/models"
+	"santiagotorres.me/user-service/repositories"
+)
+
+// Context keys set by CheckJWT, only accessed through the helpers below
+const (
+	claimsContextKey      = "claims"
+	userSessionContextKey = "userSession"
+	userContextKey        = "user"
+	permissionsContextKey = "permissions"
+)
+
+func setAuthContext(c *gin.Context, claims *models.Claims, userSession *models.UserSessions) {
+	c.Set(claimsContextKey, claims)
+	c.Set(userSessionContextKey, userSession)
+}
+
+// GetClaims returns the claims of the access token the request was authenticated with.
+func GetClaims(c *gin.Context) (*models.Claims, bool) {
+	claims, ok := c.Get(claimsContextKey)
+	if !ok {
+		return nil, false
+	}
+	return claims.(*models.Claims), true
+}
+
+// MustGetClaims returns the request's claims and panics if the route is not behind CheckJWT.
+func MustGetClaims(c *gin.Context) *models.Claims {
+	return c.MustGet(claimsContextKey).(*models.Claims)
+}
+
+// GetUserSession returns the session the request's access token belongs to.
+func GetUserSession(c *gin.Context) (*models.UserSessions, bool) {
+	userSession, ok := c.Get(userSessionContextKey)
+	if !ok {
+		return nil, false
+	}
+	return userSession.(*models.UserSessions), true
+}
+
+// MustGetUserSession returns the request's session and panics if the route is not behind CheckJWT.
+func MustGetUserSession(c *gin.Context) *models.UserSessions {
+	return c.MustGet(userSessionContextKey).(*models.UserSessions)
+}
+
+// GetCurrentUser loads the authenticated user, caching it for the rest of the request.
+func (appState *AppState) GetCurrentUser(c *gin.Context) (*models.User, error) {
+	if user, ok := c.Get(userContextKey); ok {
+		return user.(*models.User), nil
+	}
+
+	user, err := repositories.GetUser(MustGetClaims(c).UserID, appState.Db)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Set(userContextKey, user)
+	return user, nil
+}
+
+// GetPermissions loads the permissions granted to the authenticated user, caching them for the
+// rest of the request.
+func (appState *AppState) GetPermissions(c *gin.Context) ([]string, error) {
+	if permissions, ok := c.Get(permissionsContextKey); ok {
+		return permissions.([]string), nil
+	}
+
+	permissions, err := repositories.GetUserPermissions(MustGetClaims(c).UserID, appState.Db)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Set(permissionsContextKey, permissions)
+	return permissions, nil
+}
@@ -1,22 +1,54 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"santiagotorres.me/user-service/configs"
+	"santiagotorres.me/user-service/logger"
+	"santiagotorres.me/user-service/mailer"
+	"santiagotorres.me/user-service/ratelimit"
+	"santiagotorres.me/user-service/services"
 	"santiagotorres.me/user-service/utils"
 )
 
 type AppState struct {
 	Db               *gorm.DB
 	EncryptorManager *utils.EncryptorManager
+	Settings         *configs.Settings
+	Mailer           mailer.Mailer
+	TokenService     *services.TokenService
+	PasswordPolicy   *utils.PasswordPolicy
+	// Nil disables rate limiting
+	RateLimitStore ratelimit.Store
+	RateLimits     configs.RateLimits
 }
 
+// SetupRoutes registers the service routes and the default per IP rate limit, which applies
+// to every route registered after it.
 func (appState *AppState) SetupRoutes(r *gin.Engine) {
+	r.Use(appState.RateLimit("default", appState.RateLimits.Default, RateLimitByIP))
+
 	r.GET("/health", HealthCheck)
+	r.GET("/.well-known/jwks.json", appState.JWKS)
 }
 
 func HealthCheck(c *gin.Context) {
 	c.String(http.StatusOK, "pong")
 }
+
+// JWKS publishes the public keys access tokens can be verified with.
+func (appState *AppState) JWKS(c *gin.Context) {
+	jwks, err := appState.TokenService.JWKS()
+
+	if err != nil {
+		logger.Logger.ErrorContext(c.Request.Context(), "Error building JWKS", "err", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred"})
+		return
+	}
+
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(services.JWKSMaxAge.Seconds())))
+	c.JSON(http.StatusOK, jwks)
+}
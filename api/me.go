@@ -0,0 +1,62 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"santiagotorres.me/user-service/logger"
+	"santiagotorres.me/user-service/repositories"
+)
+
+func (appState *AppState) SetUpMeRoutes(r *gin.Engine) {
+	meRouter := r.Group("/me", appState.CheckJWT(), appState.RateLimit("me", appState.RateLimits.Default, RateLimitByUser))
+
+	{
+		meRouter.GET("/sessions", appState.ListSessions)
+		meRouter.DELETE("/sessions/:id", appState.RevokeSession)
+	}
+}
+
+func (appState *AppState) ListSessions(context *gin.Context) {
+	userSession := MustGetUserSession(context)
+
+	sessions, err := repositories.ListActiveSessions(userSession.UserID, userSession.UserSessionsID, appState.Db)
+
+	if err != nil {
+		logger.Logger.ErrorContext(context.Request.Context(), "Error listing sessions", "err", err.Error())
+		context.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while listing sessions",
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+func (appState *AppState) RevokeSession(context *gin.Context) {
+	sessionID, err := uuid.Parse(context.Param("id"))
+
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+		return
+	}
+
+	userSession := MustGetUserSession(context)
+
+	if err := repositories.RevokeSessionForUser(userSession.UserID, sessionID, appState.Db); err != nil {
+		if errors.Is(err, repositories.ErrSessionNotFound) {
+			context.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+
+		logger.Logger.ErrorContext(context.Request.Context(), "Error revoking session", "err", err.Error())
+		context.JSON(http.StatusInternalServerError, gin.H{
+			"error": "An error occurred while revoking the session",
+		})
+		return
+	}
+
+	context.Status(http.StatusNoContent)
+}
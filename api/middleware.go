@@ -2,14 +2,18 @@ package api
 
 import (
 	"errors"
+	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"santiagotorres.me/user-service/logger"
+	"santiagotorres.me/user-service/models"
 	"santiagotorres.me/user-service/repositories"
-	"santiagotorres.me/user-service/services"
 )
 
+// CheckJWT authenticates requests with an access token bearer and stores its claims and session
+// in the context, see GetClaims and GetUserSession.
 func (appState *AppState) CheckJWT() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -28,8 +32,7 @@ func (appState *AppState) CheckJWT() gin.HandlerFunc {
 
 		tokenString := strings.TrimPrefix(authHeader, BearerPrefix)
 
-		// Use valid secret key
-		token, claims, err := services.ValidateToken(tokenString, "secret")
+		token, claims, err := appState.TokenService.ValidateToken(tokenString)
 
 		if err != nil {
 			if errors.Is(err, jwt.ErrTokenExpired) {
@@ -37,6 +40,13 @@ func (appState *AppState) CheckJWT() gin.HandlerFunc {
 				return
 			}
 			c.AbortWithStatusJSON(401, gin.H{"error": "invalid token"})
+			return
+		}
+
+		// temp_auth tokens are only redeemable at /auth/totp/verify and refresh tokens at /auth/refresh
+		if claims.TokenType != models.AccessToken {
+			c.AbortWithStatusJSON(401, gin.H{"error": "invalid token type"})
+			return
 		}
 
 		userSession, err := repositories.GetUserSession(token.Raw, claims, appState.Db)
@@ -51,8 +61,36 @@ func (appState *AppState) CheckJWT() gin.HandlerFunc {
 			return
 		}
 
-		c.Set("claims", claims)
-		c.Set("userSession", userSession)
+		setAuthContext(c, claims, userSession)
+
+		c.Next()
+	}
+}
+
+// RequirePermission only lets requests through when the authenticated user holds every given
+// permission. It must run after CheckJWT. Permissions are read from the database rather than
+// the token's roles claim, so revoking a role applies immediately.
+func (appState *AppState) RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := GetClaims(c); !ok {
+			c.AbortWithStatusJSON(401, gin.H{"error": "missing token"})
+			return
+		}
+
+		granted, err := appState.GetPermissions(c)
+
+		if err != nil {
+			logger.Logger.ErrorContext(c.Request.Context(), "Error loading permissions", "err", err.Error())
+			c.AbortWithStatusJSON(500, gin.H{"error": "An unexpected error occurred"})
+			return
+		}
+
+		for _, permission := range permissions {
+			if !slices.Contains(granted, permission) {
+				c.AbortWithStatusJSON(403, gin.H{"error": "forbidden"})
+				return
+			}
+		}
 
 		c.Next()
 	}
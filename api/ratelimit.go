@@ -0,0 +1,62 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"santiagotorres.me/user-service/logger"
+	"santiagotorres.me/user-service/ratelimit"
+)
+
+// RateLimitKey picks the bucket a request is counted against.
+type RateLimitKey func(c *gin.Context) string
+
+// RateLimitByIP counts requests per client IP.
+func RateLimitByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// RateLimitByUser counts requests per authenticated user, falling back to the client IP.
+// It must run after CheckJWT.
+func RateLimitByUser(c *gin.Context) string {
+	if claims, ok := GetClaims(c); ok {
+		return "user:" + claims.UserID.String()
+	}
+	return RateLimitByIP(c)
+}
+
+// RateLimitByRoute counts every request to the route together, whoever sends it.
+func RateLimitByRoute(c *gin.Context) string {
+	return "route:" + c.FullPath()
+}
+
+// RateLimit limits requests sharing a scope and key to the given limit, answering 429 with
+// Retry-After once the bucket is empty. A nil limit disables the middleware. Store errors let
+// requests through so an unavailable store does not take the service down.
+func (appState *AppState) RateLimit(scope string, limit *ratelimit.Limit, key RateLimitKey) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if appState.RateLimitStore == nil || limit == nil {
+			c.Next()
+			return
+		}
+
+		result, err := appState.RateLimitStore.Take(c.Request.Context(), scope+":"+key(c), *limit)
+
+		if err != nil {
+			logger.Logger.ErrorContext(c.Request.Context(), "Error checking rate limit", "scope", scope, "err", err.Error())
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+
+		if !result.Allowed {
+			setRetryAfter(c, result.RetryAfter)
+			c.AbortWithStatusJSON(429, gin.H{"error": "Too many requests"})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,157 @@
+package breach
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// bloomMagic identifies bloom filter files, followed by the bit count and number of hash functions
+var bloomMagic = []byte("PWBF1\n")
+
+// bloomChunkWords is how many filter words are encoded at a time when reading or writing a filter
+const bloomChunkWords = 8192
+
+// BloomFilter is a probabilistic set of SHA-1 password hashes. It never misses a listed password
+// but reports unlisted ones as breached with the false positive rate it was sized for.
+type BloomFilter struct {
+	bits      []uint64
+	bitCount  uint64
+	hashCount uint32
+}
+
+// NewBloomFilter sizes a filter for the expected number of hashes and false positive rate.
+func NewBloomFilter(expectedItems uint64, falsePositiveRate float64) (*BloomFilter, error) {
+	if expectedItems == 0 || falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		return nil, errors.New("bloom filter needs a positive item count and a false positive rate between 0 and 1")
+	}
+
+	bitCount := uint64(math.Ceil(-float64(expectedItems) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	hashCount := uint32(max(1, math.Round(float64(bitCount)/float64(expectedItems)*math.Ln2)))
+
+	return &BloomFilter{
+		bits:      make([]uint64, (bitCount+63)/64),
+		bitCount:  bitCount,
+		hashCount: hashCount,
+	}, nil
+}
+
+// Add inserts a SHA-1 digest into the filter.
+func (b *BloomFilter) Add(digest [sha1.Size]byte) {
+	h1, h2 := splitDigest(digest)
+	for i := uint64(0); i < uint64(b.hashCount); i++ {
+		bit := (h1 + i*h2) % b.bitCount
+		b.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// AddHex inserts a hex encoded SHA-1 hash, as found in breach dumps.
+func (b *BloomFilter) AddHex(hash string) error {
+	var digest [sha1.Size]byte
+
+	if len(hash) != hashLength {
+		return fmt.Errorf("invalid SHA-1 hash %q", hash)
+	}
+
+	if _, err := hex.Decode(digest[:], []byte(hash)); err != nil {
+		return fmt.Errorf("invalid SHA-1 hash %q: %w", hash, err)
+	}
+
+	b.Add(digest)
+	return nil
+}
+
+// Contains reports whether the digest is probably in the filter.
+func (b *BloomFilter) Contains(digest [sha1.Size]byte) bool {
+	h1, h2 := splitDigest(digest)
+	for i := uint64(0); i < uint64(b.hashCount); i++ {
+		bit := (h1 + i*h2) % b.bitCount
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *BloomFilter) IsBreached(password string) (bool, error) {
+	return b.Contains(Digest(password)), nil
+}
+
+// splitDigest derives the two hashes of double hashing from the already uniform SHA-1 digest.
+func splitDigest(digest [sha1.Size]byte) (uint64, uint64) {
+	return binary.BigEndian.Uint64(digest[0:8]), binary.BigEndian.Uint64(digest[8:16]) | 1
+}
+
+// WriteTo serializes the filter so it can be loaded with Open.
+func (b *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	header := make([]byte, 0, len(bloomMagic)+12)
+	header = append(header, bloomMagic...)
+	header = binary.BigEndian.AppendUint64(header, b.bitCount)
+	header = binary.BigEndian.AppendUint32(header, b.hashCount)
+
+	n, err := w.Write(header)
+	written := int64(n)
+	if err != nil {
+		return written, err
+	}
+
+	// Written in chunks to avoid a second in memory copy of large filters
+	chunk := make([]byte, 0, bloomChunkWords*8)
+	for start := 0; start < len(b.bits); start += bloomChunkWords {
+		chunk = chunk[:0]
+		for _, word := range b.bits[start:min(start+bloomChunkWords, len(b.bits))] {
+			chunk = binary.BigEndian.AppendUint64(chunk, word)
+		}
+
+		n, err := w.Write(chunk)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// ReadBloomFilter loads a filter written with WriteTo.
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	header := make([]byte, len(bloomMagic)+12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	if string(header[:len(bloomMagic)]) != string(bloomMagic) {
+		return nil, errors.New("not a bloom filter file")
+	}
+
+	bitCount := binary.BigEndian.Uint64(header[len(bloomMagic):])
+	hashCount := binary.BigEndian.Uint32(header[len(bloomMagic)+8:])
+
+	if bitCount == 0 || hashCount == 0 {
+		return nil, errors.New("corrupt bloom filter header")
+	}
+
+	filter := &BloomFilter{
+		bits:      make([]uint64, (bitCount+63)/64),
+		bitCount:  bitCount,
+		hashCount: hashCount,
+	}
+
+	chunk := make([]byte, bloomChunkWords*8)
+	for start := 0; start < len(filter.bits); start += bloomChunkWords {
+		words := filter.bits[start:min(start+bloomChunkWords, len(filter.bits))]
+		if _, err := io.ReadFull(r, chunk[:len(words)*8]); err != nil {
+			return nil, err
+		}
+
+		for i := range words {
+			words[i] = binary.BigEndian.Uint64(chunk[i*8:])
+		}
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,37 @@
+// Package breach checks passwords against lists of known compromised passwords without calling
+// an external service. Lists are either a HIBP style file of SHA-1 hashes ordered by hash
+// ("<SHA-1 hex>:<count>" per line), searched in place, or a bloom filter built from such a file.
+package breach
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"os"
+)
+
+// Checker reports whether a password appears in a list of compromised passwords.
+type Checker interface {
+	IsBreached(password string) (bool, error)
+}
+
+// Digest is the SHA-1 hash passwords are indexed by in breach lists.
+func Digest(password string) [sha1.Size]byte {
+	return sha1.Sum([]byte(password))
+}
+
+// Open loads the breach list at path, detecting whether it is a bloom filter or a sorted hash file.
+func Open(path string) (Checker, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, len(bloomMagic))
+	if _, err := file.ReadAt(magic, 0); err == nil && bytes.Equal(magic, bloomMagic) {
+		defer file.Close()
+		return ReadBloomFilter(bufio.NewReader(file))
+	}
+
+	return newSortedHashFile(file)
+}
@@ -0,0 +1,122 @@
+package breach
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// hashLength is the length of a hex encoded SHA-1 hash
+const hashLength = 40
+
+// SortedHashFile binary searches a file of SHA-1 hashes ordered by hash, such as the
+// "ordered by hash" HIBP Pwned Passwords download. The file is read in place, so multi
+// gigabyte dumps can be used without loading them into memory.
+type SortedHashFile struct {
+	file *os.File
+	size int64
+}
+
+func newSortedHashFile(file *os.File) (*SortedHashFile, error) {
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &SortedHashFile{file: file, size: info.Size()}, nil
+}
+
+func (f *SortedHashFile) IsBreached(password string) (bool, error) {
+	digest := Digest(password)
+	target := strings.ToUpper(hex.EncodeToString(digest[:]))
+
+	// Search the lines starting within [lo, hi)
+	lo, hi := int64(0), f.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		start, line, next, err := f.lineAt(mid)
+		if err != nil {
+			return false, err
+		}
+
+		if start >= hi {
+			hi = mid
+			continue
+		}
+
+		if len(line) < hashLength {
+			return false, errors.New("malformed breach list line")
+		}
+
+		switch strings.Compare(strings.ToUpper(string(line[:hashLength])), target) {
+		case 0:
+			return true, nil
+		case -1:
+			lo = next
+		default:
+			hi = mid
+		}
+	}
+
+	return false, nil
+}
+
+// lineAt returns the first line starting at or after offset, with its start offset and the
+// offset of the line following it.
+func (f *SortedHashFile) lineAt(offset int64) (int64, []byte, int64, error) {
+	start := offset
+
+	if offset > 0 {
+		// Skip the rest of the line offset falls in, unless offset is already a line start
+		newline, err := f.indexNewline(offset - 1)
+		if err != nil {
+			return 0, nil, 0, err
+		}
+		start = newline + 1
+	}
+
+	if start >= f.size {
+		return start, nil, start, nil
+	}
+
+	end, err := f.indexNewline(start)
+	if err != nil {
+		return 0, nil, 0, err
+	}
+
+	line := make([]byte, end-start)
+	if _, err := f.file.ReadAt(line, start); err != nil && !errors.Is(err, io.EOF) {
+		return 0, nil, 0, err
+	}
+
+	return start, bytes.TrimRight(line, "\r"), end + 1, nil
+}
+
+// indexNewline returns the offset of the first newline at or after offset, or the file size.
+func (f *SortedHashFile) indexNewline(offset int64) (int64, error) {
+	buffer := make([]byte, 128)
+
+	for offset < f.size {
+		n, err := f.file.ReadAt(buffer, offset)
+		if i := bytes.IndexByte(buffer[:n], '\n'); i >= 0 {
+			return offset + int64(i), nil
+		}
+
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+
+		offset += int64(n)
+	}
+
+	return f.size, nil
+}
+
+func (f *SortedHashFile) Close() error {
+	return f.file.Close()
+}
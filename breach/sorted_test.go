@@ -0,0 +1,129 @@
+package breach
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type hashedPassword struct {
+	password string
+	hash     string
+}
+
+// hashedPasswords returns n passwords ordered by their SHA-1 hash, as in a breach list.
+func hashedPasswords(n int) []hashedPassword {
+	passwords := make([]hashedPassword, n)
+	for i := range passwords {
+		password := fmt.Sprintf("password-%d", i)
+		digest := Digest(password)
+		passwords[i] = hashedPassword{password: password, hash: strings.ToUpper(hex.EncodeToString(digest[:]))}
+	}
+
+	slices.SortFunc(passwords, func(a, b hashedPassword) int {
+		return strings.Compare(a.hash, b.hash)
+	})
+
+	return passwords
+}
+
+func writeSortedHashFile(t *testing.T, entries []hashedPassword, newline string, trailingNewline bool) *SortedHashFile {
+	t.Helper()
+
+	lines := make([]string, len(entries))
+	for i, entry := range entries {
+		lines[i] = fmt.Sprintf("%s:%d", entry.hash, i+1)
+	}
+
+	content := strings.Join(lines, newline)
+	if trailingNewline {
+		content += newline
+	}
+
+	path := filepath.Join(t.TempDir(), "hashes.txt")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashFile, err := newSortedHashFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { hashFile.Close() })
+
+	return hashFile
+}
+
+func TestSortedHashFileIsBreached(t *testing.T) {
+	passwords := hashedPasswords(200)
+
+	// The first and last hashes are left out so the missing passwords sort before, between and
+	// after the listed ones
+	before, after := passwords[0], passwords[len(passwords)-1]
+	between := passwords[100]
+	listed := slices.Concat(passwords[1:100], passwords[101:len(passwords)-1])
+
+	tests := []struct {
+		name            string
+		entries         []hashedPassword
+		newline         string
+		trailingNewline bool
+	}{
+		{name: "LF", entries: listed, newline: "\n", trailingNewline: true},
+		{name: "LF without trailing newline", entries: listed, newline: "\n"},
+		{name: "CRLF", entries: listed, newline: "\r\n", trailingNewline: true},
+		{name: "CRLF without trailing newline", entries: listed, newline: "\r\n"},
+		{name: "single line", entries: listed[:1], newline: "\n", trailingNewline: true},
+		{name: "two lines CRLF", entries: listed[:2], newline: "\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hashFile := writeSortedHashFile(t, tt.entries, tt.newline, tt.trailingNewline)
+
+			first, last := tt.entries[0], tt.entries[len(tt.entries)-1]
+			for _, entry := range []hashedPassword{first, last} {
+				if breached, err := hashFile.IsBreached(entry.password); err != nil || !breached {
+					t.Errorf("IsBreached(%q) = %v, %v, want true", entry.password, breached, err)
+				}
+			}
+
+			for _, entry := range tt.entries {
+				if breached, err := hashFile.IsBreached(entry.password); err != nil || !breached {
+					t.Fatalf("IsBreached(%q) = %v, %v, want true", entry.password, breached, err)
+				}
+			}
+
+			for _, entry := range []hashedPassword{before, between, after} {
+				if breached, err := hashFile.IsBreached(entry.password); err != nil || breached {
+					t.Errorf("IsBreached(%q) = %v, %v, want false", entry.password, breached, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSortedHashFileEmpty(t *testing.T) {
+	hashFile := writeSortedHashFile(t, nil, "\n", false)
+
+	if breached, err := hashFile.IsBreached("password"); err != nil || breached {
+		t.Errorf("IsBreached on an empty file = %v, %v, want false", breached, err)
+	}
+}
+
+func TestSortedHashFileMalformed(t *testing.T) {
+	hashFile := writeSortedHashFile(t, []hashedPassword{{hash: "ABC"}}, "\n", true)
+
+	if _, err := hashFile.IsBreached("password"); err == nil {
+		t.Error("IsBreached on a malformed file returned no error")
+	}
+}
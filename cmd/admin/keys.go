@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"santiagotorres.me/user-service/services"
+)
+
+var keyCommands = map[string]command{
+	"list": {
+		usage: "",
+		run:   listKeys,
+	},
+	"rotate": {
+		usage: "[-alg HS256|RS256|ES256|ES384|ES512|EdDSA]",
+		run:   rotateKey,
+	},
+	"retire": {
+		usage: "<kid>",
+		run:   retireKey,
+	},
+}
+
+func listKeys(args []string, env *environment) error {
+	keys, err := services.ListSigningKeys(env.db)
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "KID\tALG\tSTATUS\tCREATED\tACTIVATES\tRETIRES")
+
+	now := time.Now().UTC()
+	signingKid := services.CurrentSigningKid(keys, now)
+
+	for _, key := range keys {
+		status := "verify-only"
+		switch {
+		case key.Kid == signingKid:
+			status = "active"
+		case key.IsActive:
+			status = "pending"
+		case key.RetiresAt != nil && !key.RetiresAt.After(now):
+			status = "retired"
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n", key.Kid, key.Algorithm, status, formatTime(key.CreatedAt), formatTime(key.ActivatesAt), formatTime(key.RetiresAt))
+	}
+
+	return writer.Flush()
+}
+
+func rotateKey(args []string, env *environment) error {
+	flags := flag.NewFlagSet("keys rotate", flag.ContinueOnError)
+	algorithm := flags.String("alg", env.settings.JWTAlgorithm, "signing algorithm of the new key")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	signingKey, activatesAt, err := services.RotateSigningKey(*algorithm, env.db, env.encryptor)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("new key %s (%s) is published now and signs tokens from %s, previous key verifies tokens for another %s after that\n",
+		signingKey.Kid, signingKey.Method.Alg(), formatTime(&activatesAt), services.RefreshTokenTTL)
+	return nil
+}
+
+func retireKey(args []string, env *environment) error {
+	if len(args) != 1 {
+		return errors.New("usage: keys retire <kid>")
+	}
+
+	if err := services.RetireSigningKey(args[0], env.db); err != nil {
+		return err
+	}
+
+	fmt.Printf("key %s retired, tokens signed with it are no longer accepted\n", args[0])
+	return nil
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"santiagotorres.me/user-service/kms"
+)
+
+var kmsCommands = map[string]command{
+	"add-local-key": {
+		usage:      "[file]",
+		run:        addLocalKMSKey,
+		standalone: true,
+	},
+}
+
+// addLocalKMSKey appends a new key encryption key to the local KMS key file, KMS_LOCAL_KEY_FILE by
+// default. Run "secrets reencrypt" afterwards to wrap existing data keys with it.
+func addLocalKMSKey(args []string, env *environment) error {
+	keyFile := env.settings.KMSLocalKeyFile
+	if len(args) > 0 {
+		keyFile = args[0]
+	}
+
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0o700); err != nil {
+		return err
+	}
+
+	keyID, err := kms.AppendLocalKey(keyFile)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("added key %s to %s\n", keyID, keyFile)
+	return nil
+}
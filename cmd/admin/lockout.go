@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"santiagotorres.me/user-service/repositories"
+)
+
+var lockoutCommands = map[string]command{
+	"list": {
+		usage: "",
+		run:   listLockouts,
+	},
+	"unlock": {
+		usage: "-email <email> | -ip <address>",
+		run:   unlock,
+	},
+	"prune": {
+		usage: "",
+		run:   pruneAuthFailures,
+	},
+}
+
+func listLockouts(args []string, env *environment) error {
+	lockouts, err := repositories.ListLockouts(env.db)
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "KEY\tFAILURES\tLAST FAILURE\tLOCKED UNTIL")
+
+	for _, lockout := range lockouts {
+		fmt.Fprintf(writer, "%s\t%d\t%s\t%s\n", lockout.Key, lockout.Failures, formatTime(&lockout.LastFailureAt), formatTime(lockout.LockedUntil))
+	}
+
+	return writer.Flush()
+}
+
+// unlock clears the failed attempts and lockout of an account or client IP.
+func unlock(args []string, env *environment) error {
+	flags := flag.NewFlagSet("lockout unlock", flag.ContinueOnError)
+	email := flags.String("email", "", "email of the account to unlock")
+	ipAddress := flags.String("ip", "", "client IP to unlock")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var key string
+	switch {
+	case *email != "" && *ipAddress == "":
+		key = repositories.AccountLockoutKey(*email)
+	case *ipAddress != "" && *email == "":
+		key = repositories.IPLockoutKey(*ipAddress)
+	default:
+		return errors.New("usage: lockout unlock -email <email> | -ip <address>")
+	}
+
+	unlocked, err := repositories.Unlock(key, env.db)
+	if err != nil {
+		return err
+	}
+
+	if unlocked == 0 {
+		fmt.Printf("%s has no recorded failures\n", key)
+		return nil
+	}
+
+	fmt.Printf("%s unlocked\n", key)
+	return nil
+}
+
+func pruneAuthFailures(args []string, env *environment) error {
+	pruned, err := repositories.PruneAuthFailures(env.db)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("stale failure counters deleted: %d\n", pruned)
+	return nil
+}
@@ -0,0 +1,94 @@
+// Command admin runs maintenance operations against the user service database.
+//
+//	go run ./cmd/admin keys list
+//	go run ./cmd/admin keys rotate [-alg ES256]
+//	go run ./cmd/admin keys retire <kid>
+//	go run ./cmd/admin secrets reencrypt
+//	go run ./cmd/admin kms add-local-key [file]
+//	go run ./cmd/admin passwords build-filter -in pwned-passwords.txt -out breached.bloom
+//	go run ./cmd/admin passwords check [-list <file>] <password>
+//	go run ./cmd/admin lockout list
+//	go run ./cmd/admin lockout unlock -email <email> | -ip <address>
+//	go run ./cmd/admin lockout prune
+//	go run ./cmd/admin roles list
+//	go run ./cmd/admin roles grant|revoke <email> <role>
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gorm.io/gorm"
+	"santiagotorres.me/user-service/configs"
+	"santiagotorres.me/user-service/utils"
+)
+
+type command struct {
+	usage string
+	run   func(args []string, env *environment) error
+	// standalone commands only get settings, without connecting to the database or loading keys
+	standalone bool
+}
+
+type environment struct {
+	settings  *configs.Settings
+	db        *gorm.DB
+	encryptor *utils.EncryptorManager
+}
+
+var commands = map[string]map[string]command{
+	"keys":      keyCommands,
+	"secrets":   secretCommands,
+	"kms":       kmsCommands,
+	"passwords": passwordCommands,
+	"lockout":   lockoutCommands,
+	"roles":     roleCommands,
+}
+
+func main() {
+	if len(os.Args) < 3 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	group, ok := commands[os.Args[1]]
+	if !ok {
+		printUsage()
+		os.Exit(2)
+	}
+
+	cmd, ok := group[os.Args[2]]
+	if !ok {
+		printUsage()
+		os.Exit(2)
+	}
+
+	settings := configs.GetSettings()
+
+	env := &environment{settings: settings}
+
+	if !cmd.standalone {
+		env.db = configs.InitDB(configs.DatabaseConfig{
+			Host:     settings.DbHost,
+			Port:     settings.DbPort,
+			User:     settings.DbUser,
+			Password: settings.DbPassword,
+			DBName:   settings.DBName,
+		})
+		env.encryptor = configs.InitEncryptor(settings)
+	}
+
+	if err := cmd.run(os.Args[3:], env); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "usage: admin <group> <command> [args]")
+	for groupName, group := range commands {
+		for name, cmd := range group {
+			fmt.Fprintf(os.Stderr, "  %s %s %s\n", groupName, name, cmd.usage)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"santiagotorres.me/user-service/breach"
+)
+
+var passwordCommands = map[string]command{
+	"build-filter": {
+		usage:      "-in <hash dump> -out <filter> [-fp 0.001] [-min-count 1]",
+		run:        buildBreachFilter,
+		standalone: true,
+	},
+	"check": {
+		usage:      "[-list <file>] <password>",
+		run:        checkBreachedPassword,
+		standalone: true,
+	},
+}
+
+// buildBreachFilter builds a bloom filter from a HIBP style "<SHA-1 hex>:<count>" dump, to be used
+// as BREACHED_PASSWORDS_FILE when the dump itself is too large to ship. The dump is read twice,
+// once to size the filter and once to fill it.
+func buildBreachFilter(args []string, env *environment) error {
+	flags := flag.NewFlagSet("passwords build-filter", flag.ContinueOnError)
+	input := flags.String("in", "", "SHA-1 hash dump, one \"<hash>:<count>\" per line")
+	output := flags.String("out", "", "bloom filter file to write")
+	falsePositiveRate := flags.Float64("fp", 0.001, "false positive rate of the filter")
+	minCount := flags.Int("min-count", 1, "skip hashes seen fewer times than this in breaches")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *input == "" || *output == "" {
+		return errors.New("-in and -out are required")
+	}
+
+	var hashCount uint64
+	err := scanHashDump(*input, *minCount, func(string) error {
+		hashCount++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if hashCount == 0 {
+		return errors.New("no hashes found in the dump")
+	}
+
+	filter, err := breach.NewBloomFilter(hashCount, *falsePositiveRate)
+	if err != nil {
+		return err
+	}
+
+	if err := scanHashDump(*input, *minCount, filter.AddHex); err != nil {
+		return err
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	size, err := filter.WriteTo(writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("wrote %d hashes to %s (%d bytes)\n", hashCount, *output, size)
+	return nil
+}
+
+// scanHashDump calls add with the hash of every dump line whose count is at least minCount.
+// Lines without a count are always included.
+func scanHashDump(path string, minCount int, add func(hash string) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		hash, countText, hasCount := strings.Cut(line, ":")
+		if hasCount {
+			count, err := strconv.Atoi(countText)
+			if err != nil {
+				return fmt.Errorf("line %d: invalid count %q", lineNumber, countText)
+			}
+			if count < minCount {
+				continue
+			}
+		}
+
+		if err := add(hash); err != nil {
+			return fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// checkBreachedPassword looks a password up in a breach list, BREACHED_PASSWORDS_FILE by default.
+func checkBreachedPassword(args []string, env *environment) error {
+	flags := flag.NewFlagSet("passwords check", flag.ContinueOnError)
+	list := flags.String("list", env.settings.BreachedPasswordsFile, "sorted hash file or bloom filter")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 || *list == "" {
+		return errors.New("usage: passwords check [-list <file>] <password>")
+	}
+
+	checker, err := breach.Open(*list)
+	if err != nil {
+		return err
+	}
+
+	breached, err := checker.IsBreached(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("breached: %t\n", breached)
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"santiagotorres.me/user-service/repositories"
+)
+
+var roleCommands = map[string]command{
+	"list": {
+		usage: "",
+		run:   listRoles,
+	},
+	"grant": {
+		usage: "<email> <role>",
+		run:   grantRole,
+	},
+	"revoke": {
+		usage: "<email> <role>",
+		run:   revokeRole,
+	},
+}
+
+func listRoles(args []string, env *environment) error {
+	roles, err := repositories.ListRoles(env.db)
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ROLE\tPERMISSIONS")
+
+	for _, role := range roles {
+		permissions := make([]string, len(role.Permissions))
+		for i, permission := range role.Permissions {
+			permissions[i] = permission.Name
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\n", role.Name, strings.Join(permissions, ", "))
+	}
+
+	return writer.Flush()
+}
+
+// grantRole assigns a role to a user, used to bootstrap the first admin.
+func grantRole(args []string, env *environment) error {
+	if len(args) != 2 {
+		return errors.New("usage: roles grant <email> <role>")
+	}
+
+	user, err := repositories.GetUserByEmail(args[0], env.db)
+	if err != nil {
+		return err
+	}
+
+	if err := repositories.AssignRole(user.UserID, args[1], env.db); err != nil {
+		return err
+	}
+
+	fmt.Printf("role %s granted to %s\n", args[1], args[0])
+	return nil
+}
+
+func revokeRole(args []string, env *environment) error {
+	if len(args) != 2 {
+		return errors.New("usage: roles revoke <email> <role>")
+	}
+
+	user, err := repositories.GetUserByEmail(args[0], env.db)
+	if err != nil {
+		return err
+	}
+
+	if err := repositories.RemoveRole(user.UserID, args[1], env.db); err != nil {
+		return err
+	}
+
+	fmt.Printf("role %s revoked from %s\n", args[1], args[0])
+	return nil
+}
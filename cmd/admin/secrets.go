@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+
+	"santiagotorres.me/user-service/repositories"
+	"santiagotorres.me/user-service/services"
+)
+
+var secretCommands = map[string]command{
+	"reencrypt": {
+		usage: "",
+		run:   reencryptSecrets,
+	},
+}
+
+// reencryptSecrets moves every stored secret to the newest encryption key, or to the current KMS key
+// when KMS_DRIVER is set. Once it reports nothing left to migrate, older versions can be dropped from
+// ENCRYPTION_KEYS and older keys from the KMS.
+func reencryptSecrets(args []string, env *environment) error {
+	fmt.Printf("re-encrypting secrets with %s\n", env.encryptor.CurrentKey())
+
+	totpSecrets, err := repositories.ReencryptTOTPSecrets(env.encryptor, env.db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("TOTP secrets re-encrypted: %d\n", totpSecrets)
+
+	signingKeys, err := services.ReencryptSigningKeys(env.encryptor, env.db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("signing keys re-encrypted: %d\n", signingKeys)
+
+	return nil
+}
@@ -1,17 +1,77 @@
 package configs
 
-import "os"
+import (
+	"os"
+	"strconv"
+)
 
 type Settings struct {
-	DbPort        string
-	DbHost        string
-	DBName        string
-	DbUser        string
-	DbPassword    string
-	ServicePort   string
-	ServiceName   string
-	JWTSecret     string
-	EncryptionKey string
+	DbPort      string
+	DbHost      string
+	DBName      string
+	DbUser      string
+	DbPassword  string
+	ServicePort string
+	ServiceName string
+	JWTSecret   string
+	// HS256, RS256, ES256, ES384, ES512 or EdDSA
+	JWTAlgorithm string
+	// PEM encoded private key used by the asymmetric algorithms
+	// The configured key only seeds the signing keyring on first start, later keys are managed with cmd/admin
+	JWTPrivateKeyFile string
+	EncryptionKey     string
+	// Comma separated "<version>:<base64 key>" list, takes precedence over EncryptionKey
+	// The newest version encrypts, older versions are kept to decrypt until secrets are re-encrypted
+	EncryptionKeys string
+	// local, or empty to encrypt secrets directly with the keys above
+	KMSDriver string
+	// File holding the key encryption keys of the local KMS driver
+	KMSLocalKeyFile string
+	TOTPIssuer      string
+	// argon2id cost parameters for new password hashes, existing hashes are upgraded on login
+	Argon2Memory      int
+	Argon2Iterations  int
+	Argon2Parallelism int
+	// Password policy applied whenever a password is set
+	PasswordMinLength            int
+	PasswordMaxLength            int
+	PasswordRequireLower         bool
+	PasswordRequireUpper         bool
+	PasswordRequireDigit         bool
+	PasswordRequireSymbol        bool
+	PasswordDisallowPersonalInfo bool
+	// Sorted SHA-1 hash file or bloom filter of breached passwords, built with cmd/admin
+	BreachedPasswordsFile string
+	// Whether requests are rate limited, limits are "<requests>/<period>" and empty disables one
+	RateLimitEnabled            bool
+	RateLimitDefault            string
+	RateLimitSignup             string
+	RateLimitLogin              string
+	RateLimitTOTPVerify         string
+	RateLimitTOTPDisable        string
+	RateLimitForgotPassword     string
+	RateLimitResetPassword      string
+	RateLimitResendVerification string
+	// Where rate limit buckets are kept: memory, per instance, or redis, shared by every replica
+	RateLimitStore string
+	RedisAddr      string
+	RedisPassword  string
+	RedisDB        int
+	// Comma separated proxy IPs or CIDRs whose X-Forwarded-For header is trusted for the client IP
+	TrustedProxies string
+	// Frontend page the password reset link points to, the token is appended as a query parameter
+	PasswordResetURL string
+	MailDriver       string
+	MailFrom         string
+	SMTPHost         string
+	SMTPPort         string
+	SMTPUsername     string
+	SMTPPassword     string
+	MailDir          string
+	// Frontend page the email verification link points to, the token is appended as a query parameter
+	EmailVerificationURL string
+	// Whether users must verify their email address before they can log in
+	RequireVerifiedEmail bool
 }
 
 func getEnvOrDefault(key string, defaultValue string) string {
@@ -21,6 +81,24 @@ func getEnvOrDefault(key string, defaultValue string) string {
 	return defaultValue
 }
 
+func getBoolEnvOrDefault(key string, defaultValue bool) bool {
+	if value, ok := os.LookupEnv(key); ok {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getIntEnvOrDefault(key string, defaultValue int) int {
+	if value, ok := os.LookupEnv(key); ok {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
 func GetSettings() *Settings {
 	return &Settings{
 		DbPort:      getEnvOrDefault("DB_PORT", "5432"),
@@ -30,8 +108,52 @@ func GetSettings() *Settings {
 		DbPassword:  getEnvOrDefault("DB_PASSWORD", "password"),
 		ServicePort: getEnvOrDefault("SERVICE_PORT", "8080"),
 		ServiceName: getEnvOrDefault("SERVICE_NAME", "wordlee-app-backend"),
-		JWTSecret:   getEnvOrDefault("JWT_SECRET", "secret"),
+		// Dummy secret, PLEASE DO NOT USE IN PRODUCTION
+		JWTSecret:         getEnvOrDefault("JWT_SECRET", "secret"),
+		JWTAlgorithm:      getEnvOrDefault("JWT_ALGORITHM", "HS256"),
+		JWTPrivateKeyFile: getEnvOrDefault("JWT_PRIVATE_KEY_FILE", ""),
 		// Dummy key, PLEASE DO NOT USE IN PRODUCTION
-		EncryptionKey: getEnvOrDefault("ENCRYPTION_KEY", "T4ounh17Om9eLI0am09+PCqNXx6ce0ptP44sWhudf04="),
+		EncryptionKey:   getEnvOrDefault("ENCRYPTION_KEY", "T4ounh17Om9eLI0am09+PCqNXx6ce0ptP44sWhudf04="),
+		EncryptionKeys:  getEnvOrDefault("ENCRYPTION_KEYS", ""),
+		KMSDriver:       getEnvOrDefault("KMS_DRIVER", ""),
+		KMSLocalKeyFile: getEnvOrDefault("KMS_LOCAL_KEY_FILE", "./tmp/kms/keys"),
+		TOTPIssuer:      getEnvOrDefault("TOTP_ISSUER", "wordlee"),
+		// Memory in KiB
+		Argon2Memory:                 getIntEnvOrDefault("ARGON2_MEMORY", 64*1024),
+		Argon2Iterations:             getIntEnvOrDefault("ARGON2_ITERATIONS", 3),
+		Argon2Parallelism:            getIntEnvOrDefault("ARGON2_PARALLELISM", 2),
+		PasswordMinLength:            getIntEnvOrDefault("PASSWORD_MIN_LENGTH", 10),
+		PasswordMaxLength:            getIntEnvOrDefault("PASSWORD_MAX_LENGTH", 128),
+		PasswordRequireLower:         getBoolEnvOrDefault("PASSWORD_REQUIRE_LOWER", true),
+		PasswordRequireUpper:         getBoolEnvOrDefault("PASSWORD_REQUIRE_UPPER", true),
+		PasswordRequireDigit:         getBoolEnvOrDefault("PASSWORD_REQUIRE_DIGIT", true),
+		PasswordRequireSymbol:        getBoolEnvOrDefault("PASSWORD_REQUIRE_SYMBOL", false),
+		PasswordDisallowPersonalInfo: getBoolEnvOrDefault("PASSWORD_DISALLOW_PERSONAL_INFO", true),
+		BreachedPasswordsFile:        getEnvOrDefault("BREACHED_PASSWORDS_FILE", ""),
+		RateLimitEnabled:             getBoolEnvOrDefault("RATE_LIMIT_ENABLED", true),
+		RateLimitDefault:             getEnvOrDefault("RATE_LIMIT_DEFAULT", "300/1m"),
+		RateLimitSignup:              getEnvOrDefault("RATE_LIMIT_SIGNUP", "5/1h"),
+		RateLimitLogin:               getEnvOrDefault("RATE_LIMIT_LOGIN", "10/1m"),
+		RateLimitTOTPVerify:          getEnvOrDefault("RATE_LIMIT_TOTP_VERIFY", "10/1m"),
+		RateLimitTOTPDisable:         getEnvOrDefault("RATE_LIMIT_TOTP_DISABLE", "5/1h"),
+		RateLimitForgotPassword:      getEnvOrDefault("RATE_LIMIT_FORGOT_PASSWORD", "5/1h"),
+		RateLimitResetPassword:       getEnvOrDefault("RATE_LIMIT_RESET_PASSWORD", "10/1h"),
+		RateLimitResendVerification:  getEnvOrDefault("RATE_LIMIT_RESEND_VERIFICATION", "5/1h"),
+		RateLimitStore:               getEnvOrDefault("RATE_LIMIT_STORE", "memory"),
+		RedisAddr:                    getEnvOrDefault("REDIS_ADDR", "localhost:6379"),
+		RedisPassword:                getEnvOrDefault("REDIS_PASSWORD", ""),
+		RedisDB:                      getIntEnvOrDefault("REDIS_DB", 0),
+		TrustedProxies:               getEnvOrDefault("TRUSTED_PROXIES", ""),
+		PasswordResetURL:             getEnvOrDefault("PASSWORD_RESET_URL", "http://localhost:3000/reset-password"),
+		// smtp, file or log, the log driver only records recipients and subjects
+		MailDriver:           getEnvOrDefault("MAIL_DRIVER", "log"),
+		MailFrom:             getEnvOrDefault("MAIL_FROM", "no-reply@wordlee.local"),
+		SMTPHost:             getEnvOrDefault("SMTP_HOST", "localhost"),
+		SMTPPort:             getEnvOrDefault("SMTP_PORT", "1025"),
+		SMTPUsername:         getEnvOrDefault("SMTP_USERNAME", ""),
+		SMTPPassword:         getEnvOrDefault("SMTP_PASSWORD", ""),
+		MailDir:              getEnvOrDefault("MAIL_DIR", "./tmp/mail"),
+		EmailVerificationURL: getEnvOrDefault("EMAIL_VERIFICATION_URL", "http://localhost:3000/verify-email"),
+		RequireVerifiedEmail: getBoolEnvOrDefault("REQUIRE_VERIFIED_EMAIL", false),
 	}
 }
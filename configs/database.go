@@ -1,12 +1,16 @@
 package configs
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"santiagotorres.me/user-service/logger"
 	"santiagotorres.me/user-service/models"
+	"santiagotorres.me/user-service/services"
 )
 
 type DatabaseConfig struct {
@@ -30,11 +34,26 @@ func InitDB(cfg DatabaseConfig) *gorm.DB {
 		panic(err)
 	}
 
-	if err := db.AutoMigrate(&models.User{}, &models.UserTOTP{}, &models.UserSessions{}); err != nil {
+	if err := dedupeUserTOTP(db); err != nil {
+		logger.Logger.Error("Failed to remove duplicate TOTP records", "err", err.Error())
+		panic(err)
+	}
+
+	if err := db.AutoMigrate(&models.User{}, &models.UserTOTP{}, &models.UserSessions{}, &models.UserRecoveryCode{}, &models.OneTimeToken{}, &models.JWTSigningKey{}, &models.AuthFailure{}, &models.Role{}, &models.Permission{}); err != nil {
 		logger.Logger.Error("Failed to migrate models", "err", err.Error())
 		panic(err)
 	}
 
+	if err := backfillSessionExpiry(db, services.RefreshTokenTTL); err != nil {
+		logger.Logger.Error("Failed to backfill session expiry", "err", err.Error())
+		panic(err)
+	}
+
+	if err := seedRoles(db); err != nil {
+		logger.Logger.Error("Failed to seed roles", "err", err.Error())
+		panic(err)
+	}
+
 	sqlDb, err := db.DB()
 
 	if err != nil {
@@ -46,3 +65,73 @@ func InitDB(cfg DatabaseConfig) *gorm.DB {
 
 	return db
 }
+
+// dedupeUserTOTP keeps a single TOTP record per user, preferring the enabled and most recent one,
+// so the unique index on user_totps.user_id can be created on databases that hold duplicates.
+func dedupeUserTOTP(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&models.UserTOTP{}) {
+		return nil
+	}
+
+	// NULLs sort last, in a row comparison they would keep the duplicate and fail the unique index
+	return db.Exec(`
+		DELETE FROM user_totps
+		WHERE user_totp_id IN (
+			SELECT user_totp_id FROM (
+				SELECT user_totp_id, ROW_NUMBER() OVER (
+					PARTITION BY user_id
+					ORDER BY is_enabled DESC NULLS LAST, created_at DESC NULLS LAST, user_totp_id DESC
+				) AS rank
+				FROM user_totps
+			) ranked
+			WHERE rank > 1
+		)
+	`).Error
+}
+
+// backfillSessionExpiry sets the expiry of sessions created before it was stored, assuming their
+// refresh token was issued when the session was created.
+func backfillSessionExpiry(db *gorm.DB, refreshTokenTTL time.Duration) error {
+	return db.Exec(
+		"UPDATE user_sessions SET expires_at = created_at + make_interval(secs => ?) WHERE expires_at IS NULL",
+		int64(refreshTokenTTL.Seconds()),
+	).Error
+}
+
+// seedRoles creates the built in roles and permissions and grants each role its default
+// permissions. Permissions granted by hand are left untouched.
+func seedRoles(db *gorm.DB) error {
+	ctx := context.Background()
+	doNothing := clause.OnConflict{Columns: []clause.Column{{Name: "name"}}, DoNothing: true}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for roleName, permissionNames := range models.DefaultRolePermissions {
+			if err := gorm.G[models.Role](tx, doNothing).Create(ctx, &models.Role{Name: roleName}); err != nil {
+				return err
+			}
+
+			role, err := gorm.G[models.Role](tx).Where("name = ?", roleName).First(ctx)
+			if err != nil {
+				return err
+			}
+
+			permissions := make([]models.Permission, len(permissionNames))
+			for i, permissionName := range permissionNames {
+				if err := gorm.G[models.Permission](tx, doNothing).Create(ctx, &models.Permission{Name: permissionName}); err != nil {
+					return err
+				}
+
+				if permissions[i], err = gorm.G[models.Permission](tx).Where("name = ?", permissionName).First(ctx); err != nil {
+					return err
+				}
+			}
+
+			// Appending skips permissions the role already has
+			if err := tx.Model(&role).Association("Permissions").Append(permissions); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,87 @@
+package configs
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"santiagotorres.me/user-service/kms"
+	"santiagotorres.me/user-service/logger"
+	"santiagotorres.me/user-service/utils"
+)
+
+// InitEncryptor builds the encryptor manager. EncryptionKeys is a comma separated list of
+// "<version>:<base64 key>" entries; when it is empty, EncryptionKey is used as key version 1.
+// When a KMS driver is configured new secrets are envelope encrypted and the keys above are only
+// used to decrypt secrets written before.
+func InitEncryptor(settings *Settings) *utils.EncryptorManager {
+	keys, err := parseEncryptionKeys(settings.EncryptionKey, settings.EncryptionKeys)
+
+	if err != nil {
+		logger.Logger.Error("Error decoding encryption key", "err", err.Error())
+		panic("Error decoding encryption key")
+	}
+
+	keyManager, err := kms.New(kms.Config{
+		Driver:       settings.KMSDriver,
+		LocalKeyFile: settings.KMSLocalKeyFile,
+	})
+
+	if err != nil {
+		logger.Logger.Error("Error initializing KMS", "err", err.Error())
+		panic("Error initializing KMS")
+	}
+
+	var encryptorManager *utils.EncryptorManager
+
+	if keyManager != nil {
+		encryptorManager, err = utils.NewEnvelopeEncryptorManager(keyManager, keys)
+	} else {
+		encryptorManager, err = utils.NewVersionedEncryptorManager(keys)
+	}
+
+	if err != nil {
+		logger.Logger.Error("Error initializing encryptor manager", "err", err.Error())
+		panic("Error initializing encryptor manager")
+	}
+
+	return encryptorManager
+}
+
+func parseEncryptionKeys(encryptionKey string, encryptionKeys string) (map[int][]byte, error) {
+	if strings.TrimSpace(encryptionKeys) == "" {
+		decodedKey, err := base64.StdEncoding.DecodeString(encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		return map[int][]byte{1: decodedKey}, nil
+	}
+
+	keys := make(map[int][]byte)
+
+	for _, entry := range strings.Split(encryptionKeys, ",") {
+		versionText, encodedKey, found := strings.Cut(strings.TrimSpace(entry), ":")
+		if !found {
+			return nil, fmt.Errorf("encryption key entry %q must be <version>:<base64 key>", entry)
+		}
+
+		version, err := strconv.Atoi(versionText)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key version %q", versionText)
+		}
+
+		decodedKey, err := base64.StdEncoding.DecodeString(encodedKey)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key version %d: %w", version, err)
+		}
+
+		if _, exists := keys[version]; exists {
+			return nil, fmt.Errorf("duplicate encryption key version %d", version)
+		}
+
+		keys[version] = decodedKey
+	}
+
+	return keys, nil
+}
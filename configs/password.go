@@ -0,0 +1,59 @@
+package configs
+
+import (
+	"fmt"
+
+	"santiagotorres.me/user-service/breach"
+	"santiagotorres.me/user-service/logger"
+	"santiagotorres.me/user-service/utils"
+)
+
+// InitPasswordHasher configures the argon2id hasher new passwords are hashed with.
+func InitPasswordHasher(settings *Settings) {
+	params := utils.DefaultArgon2Params
+	params.Memory = uint32(settings.Argon2Memory)
+	params.Iterations = uint32(settings.Argon2Iterations)
+	params.Parallelism = uint8(settings.Argon2Parallelism)
+
+	hasher, err := utils.NewArgon2idHasher(params)
+
+	if err != nil {
+		logger.Logger.Error("Error initializing password hasher", "err", err.Error())
+		panic("Error initializing password hasher")
+	}
+
+	utils.SetPasswordHasher(hasher)
+}
+
+// InitPasswordPolicy builds the password policy every new password is checked against, including
+// the breached password list when one is configured.
+func InitPasswordPolicy(settings *Settings) *utils.PasswordPolicy {
+	if settings.PasswordMinLength < 1 || (settings.PasswordMaxLength > 0 && settings.PasswordMaxLength < settings.PasswordMinLength) {
+		err := fmt.Errorf("invalid password length bounds %d-%d", settings.PasswordMinLength, settings.PasswordMaxLength)
+		logger.Logger.Error("Error initializing password policy", "err", err.Error())
+		panic("Error initializing password policy")
+	}
+
+	policy := &utils.PasswordPolicy{
+		MinLength:            settings.PasswordMinLength,
+		MaxLength:            settings.PasswordMaxLength,
+		RequireLower:         settings.PasswordRequireLower,
+		RequireUpper:         settings.PasswordRequireUpper,
+		RequireDigit:         settings.PasswordRequireDigit,
+		RequireSymbol:        settings.PasswordRequireSymbol,
+		DisallowPersonalInfo: settings.PasswordDisallowPersonalInfo,
+	}
+
+	if settings.BreachedPasswordsFile != "" {
+		checker, err := breach.Open(settings.BreachedPasswordsFile)
+
+		if err != nil {
+			logger.Logger.Error("Error loading breached passwords list", "err", err.Error())
+			panic("Error loading breached passwords list")
+		}
+
+		policy.BreachChecker = checker
+	}
+
+	return policy
+}
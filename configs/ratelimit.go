@@ -0,0 +1,84 @@
+package configs
+
+import (
+	"context"
+	"time"
+
+	"santiagotorres.me/user-service/logger"
+	"santiagotorres.me/user-service/ratelimit"
+)
+
+// RateLimits are the request limits of the rate limited routes, nil when a limit is disabled.
+type RateLimits struct {
+	Default            *ratelimit.Limit
+	Signup             *ratelimit.Limit
+	Login              *ratelimit.Limit
+	TOTPVerify         *ratelimit.Limit
+	TOTPDisable        *ratelimit.Limit
+	ForgotPassword     *ratelimit.Limit
+	ResetPassword      *ratelimit.Limit
+	ResendVerification *ratelimit.Limit
+}
+
+// InitRateLimits parses the configured limits. An empty limit disables it.
+func InitRateLimits(settings *Settings) RateLimits {
+	return RateLimits{
+		Default:            parseRateLimit("RATE_LIMIT_DEFAULT", settings.RateLimitDefault),
+		Signup:             parseRateLimit("RATE_LIMIT_SIGNUP", settings.RateLimitSignup),
+		Login:              parseRateLimit("RATE_LIMIT_LOGIN", settings.RateLimitLogin),
+		TOTPVerify:         parseRateLimit("RATE_LIMIT_TOTP_VERIFY", settings.RateLimitTOTPVerify),
+		TOTPDisable:        parseRateLimit("RATE_LIMIT_TOTP_DISABLE", settings.RateLimitTOTPDisable),
+		ForgotPassword:     parseRateLimit("RATE_LIMIT_FORGOT_PASSWORD", settings.RateLimitForgotPassword),
+		ResetPassword:      parseRateLimit("RATE_LIMIT_RESET_PASSWORD", settings.RateLimitResetPassword),
+		ResendVerification: parseRateLimit("RATE_LIMIT_RESEND_VERIFICATION", settings.RateLimitResendVerification),
+	}
+}
+
+const (
+	RateLimitStoreMemory = "memory"
+	RateLimitStoreRedis  = "redis"
+)
+
+// InitRateLimitStore creates the configured bucket store, nil when rate limiting is disabled.
+// The redis store is checked at startup so a wrong address fails fast instead of every request
+// silently going unlimited.
+func InitRateLimitStore(settings *Settings) ratelimit.Store {
+	if !settings.RateLimitEnabled {
+		return nil
+	}
+
+	switch settings.RateLimitStore {
+	case RateLimitStoreMemory:
+		return ratelimit.NewMemoryStore()
+	case RateLimitStoreRedis:
+		client := ratelimit.NewRESPClient(settings.RedisAddr, settings.RedisPassword, settings.RedisDB, 16)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := client.Ping(ctx); err != nil {
+			logger.Logger.Error("Error connecting to Redis", "addr", settings.RedisAddr, "err", err.Error())
+			panic("Error connecting to Redis")
+		}
+
+		return ratelimit.NewRedisStore(client, "ratelimit:")
+	default:
+		logger.Logger.Error("Unknown rate limit store", "store", settings.RateLimitStore)
+		panic("Unknown rate limit store")
+	}
+}
+
+func parseRateLimit(name string, value string) *ratelimit.Limit {
+	if value == "" {
+		return nil
+	}
+
+	limit, err := ratelimit.ParseLimit(value)
+
+	if err != nil {
+		logger.Logger.Error("Error parsing rate limit", "setting", name, "err", err.Error())
+		panic("Error parsing rate limit")
+	}
+
+	return &limit
+}
@@ -0,0 +1,48 @@
+// Package kms wraps and unwraps data encryption keys with key encryption keys held by a key
+// management service, so services never hold the master key in their configuration.
+//
+// Secrets are encrypted with a fresh data key per record (envelope encryption); only the wrapped
+// data key is stored next to the ciphertext. A cloud implementation maps WrapKey and UnwrapKey to
+// the provider's Encrypt and Decrypt calls (AWS KMS, GCP Cloud KMS, Vault transit) and uses the
+// provider key ARN or resource name as the key ID.
+package kms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+const (
+	DriverLocal = "local"
+)
+
+var ErrUnknownKey = errors.New("unknown key encryption key")
+
+// KMS wraps data keys with a key encryption key that never leaves the key management service.
+type KMS interface {
+	// KeyID identifies the key encryption key new data keys are wrapped with.
+	KeyID() string
+	// WrapKey encrypts a data key with the current key encryption key.
+	WrapKey(ctx context.Context, dataKey []byte) ([]byte, error)
+	// UnwrapKey decrypts a data key wrapped with the key encryption key identified by keyID.
+	UnwrapKey(ctx context.Context, keyID string, wrappedKey []byte) ([]byte, error)
+}
+
+type Config struct {
+	Driver string
+	// Key file used by the local driver
+	LocalKeyFile string
+}
+
+// New builds the KMS for the configured driver. It returns nil when no driver is configured.
+func New(cfg Config) (KMS, error) {
+	switch cfg.Driver {
+	case "":
+		return nil, nil
+	case DriverLocal:
+		return NewLocalKMS(cfg.LocalKeyFile)
+	default:
+		return nil, fmt.Errorf("unknown KMS driver %q", cfg.Driver)
+	}
+}
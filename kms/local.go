@@ -0,0 +1,133 @@
+package kms
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// LocalKMS keeps key encryption keys in a local file, one "<key id> <base64 key>" pair per line.
+// The last key in the file wraps new data keys; earlier keys only unwrap. Meant for development
+// and tests, production deployments should use a managed KMS.
+type LocalKMS struct {
+	keys         map[string]cipher.AEAD
+	currentKeyID string
+}
+
+func NewLocalKMS(keyFile string) (*LocalKMS, error) {
+	file, err := os.Open(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	localKMS := &LocalKMS{keys: make(map[string]cipher.AEAD)}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		keyID, encodedKey, found := strings.Cut(line, " ")
+		if !found {
+			return nil, fmt.Errorf("invalid key line %q, expected \"<key id> <base64 key>\"", line)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encodedKey))
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", keyID, err)
+		}
+
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %s must be 32 bytes", keyID)
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		localKMS.keys[keyID] = gcm
+		localKMS.currentKeyID = keyID
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if localKMS.currentKeyID == "" {
+		return nil, errors.New("KMS key file holds no keys")
+	}
+
+	return localKMS, nil
+}
+
+func (k *LocalKMS) KeyID() string {
+	return k.currentKeyID
+}
+
+func (k *LocalKMS) WrapKey(ctx context.Context, dataKey []byte) ([]byte, error) {
+	gcm := k.keys[k.currentKeyID]
+	nonce := make([]byte, gcm.NonceSize())
+
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	// The key ID is authenticated so a wrapped key cannot be presented as wrapped by another key
+	return gcm.Seal(nonce, nonce, dataKey, []byte(k.currentKeyID)), nil
+}
+
+func (k *LocalKMS) UnwrapKey(ctx context.Context, keyID string, wrappedKey []byte) ([]byte, error) {
+	gcm, ok := k.keys[keyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	if len(wrappedKey) < gcm.NonceSize() {
+		return nil, errors.New("wrapped key too short")
+	}
+
+	nonce, cipherText := wrappedKey[:gcm.NonceSize()], wrappedKey[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, cipherText, []byte(keyID))
+}
+
+// AppendLocalKey generates a new key encryption key and appends it to the key file, creating the
+// file if needed. The new key becomes the current one the next time the file is loaded.
+func AppendLocalKey(keyFile string) (string, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+
+	keyID := uuid.New().String()
+
+	file, err := os.OpenFile(keyFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := fmt.Fprintf(file, "%s %s\n", keyID, base64.StdEncoding.EncodeToString(key)); err != nil {
+		return "", err
+	}
+
+	return keyID, nil
+}
@@ -0,0 +1,44 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"santiagotorres.me/user-service/logger"
+)
+
+// FileMailer writes every message as an .eml file into a directory, so development emails
+// can be opened in a mail client without running an SMTP server.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir string, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, message Message) error {
+	body, err := buildMIME(m.from, message)
+	if err != nil {
+		return err
+	}
+
+	fileName := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), uuid.New().String())
+	path := filepath.Join(m.dir, fileName)
+
+	if err := os.WriteFile(path, body, 0o640); err != nil {
+		return err
+	}
+
+	logger.Logger.InfoContext(ctx, "Outbound email written to file", "to", message.To, "subject", message.Subject, "path", path)
+	return nil
+}
@@ -0,0 +1,65 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+
+	"santiagotorres.me/user-service/logger"
+)
+
+const (
+	DriverSMTP = "smtp"
+	DriverFile = "file"
+	DriverLog  = "log"
+)
+
+// Message is an outbound email with a plain text body and an optional HTML alternative.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers outbound email.
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+type Config struct {
+	Driver   string
+	From     string
+	Host     string
+	Port     string
+	Username string
+	Password string
+	// Directory the file driver writes messages to
+	Dir string
+}
+
+// New builds the mailer for the configured driver.
+func New(cfg Config) (Mailer, error) {
+	switch cfg.Driver {
+	case DriverSMTP:
+		return NewSMTPMailer(cfg.Host, cfg.Port, cfg.Username, cfg.Password, cfg.From), nil
+	case DriverFile:
+		return NewFileMailer(cfg.Dir, cfg.From)
+	case DriverLog, "":
+		return NewLogMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+}
+
+// LogMailer logs that a message would have been sent instead of delivering it. Bodies are never
+// logged since they carry password reset and verification tokens; use the file driver to read them.
+type LogMailer struct{}
+
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+func (m *LogMailer) Send(ctx context.Context, message Message) error {
+	logger.Logger.InfoContext(ctx, "Outbound email", "to", message.To, "subject", message.Subject)
+	return nil
+}
@@ -1,14 +1,17 @@
 package main
 
 import (
-	"encoding/base64"
+	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"santiagotorres.me/user-service/api"
 	"santiagotorres.me/user-service/configs"
 	"santiagotorres.me/user-service/logger"
-	"santiagotorres.me/user-service/utils"
+	"santiagotorres.me/user-service/mailer"
+	"santiagotorres.me/user-service/services"
 )
 
 func main() {
@@ -24,29 +27,78 @@ func main() {
 		DBName:   settings.DBName,
 	}
 
-	decodedSecret, base64Err := base64.StdEncoding.DecodeString(settings.EncryptionKey)
+	db := configs.InitDB(dbConfig)
+	encryptorManager := configs.InitEncryptor(settings)
+	configs.InitPasswordHasher(settings)
+	passwordPolicy := configs.InitPasswordPolicy(settings)
 
-	if base64Err != nil {
-		logger.Logger.Error("Error decoding encryption key", "err", base64Err.Error())
-		panic("Error decoding encryption key")
+	signingKey, signingKeyErr := services.LoadSigningKey(settings.JWTAlgorithm, settings.JWTSecret, settings.JWTPrivateKeyFile)
+
+	if signingKeyErr != nil {
+		logger.Logger.Error("Error loading JWT signing key", "err", signingKeyErr.Error())
+		panic("Error loading JWT signing key")
+	}
+
+	keyring, keyringErr := services.LoadKeyring(signingKey, db, encryptorManager)
+
+	if keyringErr != nil {
+		logger.Logger.Error("Error loading JWT signing keyring", "err", keyringErr.Error())
+		panic("Error loading JWT signing keyring")
+	}
+
+	// Pick up keys rotated through the admin command, possibly from another replica
+	go keyring.Watch(context.Background(), time.Minute)
+
+	tokenService, tokenServiceErr := services.NewTokenService(keyring)
+
+	if tokenServiceErr != nil {
+		logger.Logger.Error("Error initializing token service", "err", tokenServiceErr.Error())
+		panic("Error initializing token service")
 	}
 
-	encryptorManager, encryptorErr := utils.NewEncryptorManager(decodedSecret)
+	mailSender, mailerErr := mailer.New(mailer.Config{
+		Driver:   settings.MailDriver,
+		From:     settings.MailFrom,
+		Host:     settings.SMTPHost,
+		Port:     settings.SMTPPort,
+		Username: settings.SMTPUsername,
+		Password: settings.SMTPPassword,
+		Dir:      settings.MailDir,
+	})
 
-	if encryptorErr != nil {
-		logger.Logger.Error("Error initializing encryptor manager", "err", encryptorErr.Error())
-		panic("Error initializing encryptor manager")
+	if mailerErr != nil {
+		logger.Logger.Error("Error initializing mailer", "err", mailerErr.Error())
+		panic("Error initializing mailer")
 	}
 
 	appState := api.AppState{
-		Db:               configs.InitDB(dbConfig),
+		Db:               db,
 		EncryptorManager: encryptorManager,
+		Settings:         settings,
+		Mailer:           mailSender,
+		TokenService:     tokenService,
+		PasswordPolicy:   passwordPolicy,
+		RateLimitStore:   configs.InitRateLimitStore(settings),
+		RateLimits:       configs.InitRateLimits(settings),
 	}
 
 	r := gin.Default()
 
+	// Client IPs key rate limits and lockouts, so forwarded headers are only trusted from known proxies
+	var trustedProxies []string
+	if settings.TrustedProxies != "" {
+		trustedProxies = strings.Split(settings.TrustedProxies, ",")
+	}
+
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		logger.Logger.Error("Error setting trusted proxies", "err", err.Error())
+		panic("Error setting trusted proxies")
+	}
+
 	appState.SetupRoutes(r)
 	appState.SetUpAuthRoutes(r)
+	appState.SetUpMeRoutes(r)
+	appState.SetUpAdminRoutes(r)
 
 	err := r.Run(fmt.Sprintf(":%s", settings.ServicePort))
 	if err != nil {
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// AuthFailure counts recent failed authentication attempts against an account or from a client IP.
+type AuthFailure struct {
+	// "account:<email>" or "ip:<address>"
+	Key           string `gorm:"primaryKey"`
+	Failures      int
+	LastFailureAt time.Time
+	// Attempts are rejected until this time once the failures pass the lockout threshold
+	LockedUntil *time.Time `gorm:"index"`
+}
@@ -16,6 +16,9 @@ type Claims struct {
 	Email        string    `json:"email"`
 	TokenType    string    `json:"type"` // "temp_auth" or "access_token" or "refresh_token"
 	TOTPVerified bool      `json:"totp_verified"`
+	FamilyID     string    `json:"fid,omitempty"`   // session family the token pair belongs to
+	Generation   int       `json:"gen,omitempty"`   // number of rotations within the family
+	Roles        []string  `json:"roles,omitempty"` // role names of the user when the token was issued
 	jwt.RegisteredClaims
 }
 
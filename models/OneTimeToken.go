@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PasswordResetPurpose     = "password_reset"
+	EmailVerificationPurpose = "email_verification"
+)
+
+// OneTimeToken is a short lived, single use token sent to a user out of band, stored only as a hash.
+type OneTimeToken struct {
+	OneTimeTokenID uuid.UUID `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	UserID         uuid.UUID `gorm:"type:uuid;index"`
+	Purpose        string    `gorm:"index"`
+	TokenHash      string    `gorm:"uniqueIndex"`
+	ExpiresAt      time.Time
+	UsedAt         *time.Time
+	CreatedAt      *time.Time `gorm:"default:now()"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Permissions checked by RequirePermission, named "<resource>:<action>"
+const (
+	UsersReadPermission   = "users:read"
+	UsersWritePermission  = "users:write"
+	RolesManagePermission = "roles:manage"
+)
+
+// Built in roles, created on startup
+const (
+	AdminRole   = "admin"
+	SupportRole = "support"
+)
+
+// DefaultRolePermissions are the permissions the built in roles are granted on startup.
+var DefaultRolePermissions = map[string][]string{
+	AdminRole:   {UsersReadPermission, UsersWritePermission, RolesManagePermission},
+	SupportRole: {UsersReadPermission},
+}
+
+// Role groups permissions that are granted to users together.
+type Role struct {
+	RoleID      uuid.UUID    `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"role_id"`
+	Name        string       `gorm:"uniqueIndex" json:"name"`
+	Permissions []Permission `gorm:"many2many:role_permissions;joinForeignKey:RoleID;joinReferences:PermissionID;constraint:OnDelete:CASCADE" json:"permissions,omitempty"`
+	CreatedAt   *time.Time   `gorm:"default:now()" json:"created_at"`
+}
+
+// Permission is a single action a role allows.
+type Permission struct {
+	PermissionID uuid.UUID `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"permission_id"`
+	Name         string    `gorm:"uniqueIndex" json:"name"`
+}
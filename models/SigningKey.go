@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// JWTSigningKey is a key of the token signing keyring. The private key is stored encrypted.
+// The active key is the newest one; it is published for verification right away but only signs
+// tokens from ActivatesAt, until then the previous key keeps signing. Other keys only verify
+// tokens until RetiresAt.
+type JWTSigningKey struct {
+	Kid        string `gorm:"primaryKey"`
+	Algorithm  string
+	PrivateKey string
+	IsActive   bool       `gorm:"default:false"`
+	CreatedAt  *time.Time `gorm:"default:now()"`
+	// Nil for keys that signed from the moment they were created
+	ActivatesAt *time.Time
+	RetiresAt   *time.Time
+}
+
+// SigningSince returns when the key started, or starts, signing tokens.
+func (k JWTSigningKey) SigningSince() time.Time {
+	if k.ActivatesAt != nil {
+		return *k.ActivatesAt
+	}
+	if k.CreatedAt != nil {
+		return *k.CreatedAt
+	}
+	return time.Time{}
+}
@@ -8,35 +8,58 @@ import (
 )
 
 type User struct {
-	UserID       uuid.UUID      `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-	Name         string         `json:"name"`
-	Email        string         `gorm:"uniqueIndex" json:"email"`
-	Password     string         `json:"password"`
-	CreatedAt    *time.Time     `gorm:"default:now()"`
-	UpdatedAt    *time.Time     `gorm:"default:now()"`
-	UserTOTP     UserTOTP       `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
-	UserSessions []UserSessions `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	UserID   uuid.UUID `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	Name     string    `json:"name"`
+	Email    string    `gorm:"uniqueIndex" json:"email"`
+	Password string    `json:"password"`
+	// Set once the user follows the verification link sent on signup
+	EmailVerifiedAt *time.Time `json:"-"`
+	// Disabled users cannot log in, set and cleared through the admin API
+	DisabledAt *time.Time `json:"-"`
+	// Set when an admin forces a password reset, login is refused until the password is reset
+	PasswordResetRequired bool           `gorm:"default:false" json:"-"`
+	CreatedAt             *time.Time     `gorm:"default:now()"`
+	UpdatedAt             *time.Time     `gorm:"default:now()"`
+	UserTOTP              UserTOTP       `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	UserSessions          []UserSessions `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+
+	UserRecoveryCodes []UserRecoveryCode `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	OneTimeTokens     []OneTimeToken     `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	Roles             []Role             `gorm:"many2many:user_roles;joinForeignKey:UserID;joinReferences:RoleID;constraint:OnDelete:CASCADE" json:"-"`
 }
 
 type UserTOTP struct {
 	UserTOTPID uuid.UUID `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-	UserID     uuid.UUID `gorm:"type:uuid"`
+	UserID     uuid.UUID `gorm:"type:uuid;uniqueIndex"`
 	Secret     string
 	IsEnabled  bool
 	LastUsedAt *time.Time
 	CreatedAt  *time.Time `gorm:"default:now()"`
 }
 
+// UserRecoveryCode is a single use MFA recovery code, stored only as a hash.
+type UserRecoveryCode struct {
+	UserRecoveryCodeID uuid.UUID `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	UserID             uuid.UUID `gorm:"type:uuid;index"`
+	CodeHash           string
+	UsedAt             *time.Time
+	CreatedAt          *time.Time `gorm:"default:now()"`
+}
+
 type UserSessions struct {
 	UserSessionsID   uuid.UUID `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
 	TokenID          string    `gorm:"uniqueIndex"`
 	TokenHash        string
 	RefreshTokenID   string `gorm:"uniqueIndex"`
 	RefreshTokenHash string
+	FamilyID         uuid.UUID `gorm:"type:uuid;index"`
+	Generation       int       `gorm:"default:0"`
 	DeviceInfo       datatypes.JSON
 	IsRevoked        bool       `gorm:"default:false"`
 	CreatedAt        *time.Time `gorm:"default:now()"`
-	UserID           uuid.UUID
+	// Expiry of the session's current refresh token, moved forward on every rotation
+	ExpiresAt *time.Time `gorm:"index"`
+	UserID    uuid.UUID
 }
 
 type DeviceInfo struct {
@@ -46,3 +69,45 @@ type DeviceInfo struct {
 	Browser    string `json:"browser,omitempty"`
 	OS         string `json:"os,omitempty"`
 }
+
+// SessionInfo is the user facing view of a session, as listed in account settings.
+type SessionInfo struct {
+	SessionID  uuid.UUID  `json:"session_id"`
+	DeviceInfo DeviceInfo `json:"device_info"`
+	CreatedAt  *time.Time `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	Current    bool       `json:"current"`
+}
+
+// UserSummary is the admin view of a user in user listings.
+type UserSummary struct {
+	UserID                uuid.UUID  `json:"user_id"`
+	Name                  string     `json:"name"`
+	Email                 string     `json:"email"`
+	EmailVerified         bool       `json:"email_verified"`
+	TOTPEnabled           bool       `json:"totp_enabled"`
+	Disabled              bool       `json:"disabled"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	CreatedAt             *time.Time `json:"created_at"`
+}
+
+// UserDetail is the admin view of a single user.
+type UserDetail struct {
+	UserSummary
+	Roles                  []string      `json:"roles"`
+	RecoveryCodesRemaining int           `json:"recovery_codes_remaining"`
+	Sessions               []SessionInfo `json:"sessions"`
+}
+
+func NewUserSummary(user *User) UserSummary {
+	return UserSummary{
+		UserID:                user.UserID,
+		Name:                  user.Name,
+		Email:                 user.Email,
+		EmailVerified:         user.EmailVerifiedAt != nil,
+		TOTPEnabled:           user.UserTOTP.IsEnabled,
+		Disabled:              user.DisabledAt != nil,
+		PasswordResetRequired: user.PasswordResetRequired,
+		CreatedAt:             user.CreatedAt,
+	}
+}
@@ -0,0 +1,134 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestMemoryStore() (*MemoryStore, *fakeClock) {
+	clock := &fakeClock{now: time.Now()}
+	store := NewMemoryStore()
+	store.now = clock.Now
+	store.lastSweep = clock.now
+	return store, clock
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	ctx := context.Background()
+	limit := Limit{Burst: 3, Period: 3 * time.Second}
+
+	type step struct {
+		advance       time.Duration
+		wantAllowed   bool
+		wantRemaining int
+		wantRetry     time.Duration
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "burst then denied",
+			steps: []step{
+				{wantAllowed: true, wantRemaining: 2},
+				{wantAllowed: true, wantRemaining: 1},
+				{wantAllowed: true, wantRemaining: 0},
+				{wantAllowed: false, wantRemaining: 0, wantRetry: time.Second},
+			},
+		},
+		{
+			name: "refills one token per second",
+			steps: []step{
+				{wantAllowed: true, wantRemaining: 2},
+				{wantAllowed: true, wantRemaining: 1},
+				{wantAllowed: true, wantRemaining: 0},
+				{advance: 500 * time.Millisecond, wantAllowed: false, wantRemaining: 0, wantRetry: 500 * time.Millisecond},
+				{advance: 500 * time.Millisecond, wantAllowed: true, wantRemaining: 0},
+				{wantAllowed: false, wantRemaining: 0, wantRetry: time.Second},
+			},
+		},
+		{
+			name: "refill is capped at the burst",
+			steps: []step{
+				{wantAllowed: true, wantRemaining: 2},
+				{advance: time.Hour, wantAllowed: true, wantRemaining: 2},
+				{wantAllowed: true, wantRemaining: 1},
+				{wantAllowed: true, wantRemaining: 0},
+				{wantAllowed: false, wantRemaining: 0, wantRetry: time.Second},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, clock := newTestMemoryStore()
+
+			for i, step := range tt.steps {
+				clock.Advance(step.advance)
+
+				result, err := store.Take(ctx, "key", limit)
+				if err != nil {
+					t.Fatalf("step %d: Take returned %v", i, err)
+				}
+
+				if result.Allowed != step.wantAllowed || result.Remaining != step.wantRemaining {
+					t.Fatalf("step %d: got allowed %v remaining %d, want %v and %d", i, result.Allowed, result.Remaining, step.wantAllowed, step.wantRemaining)
+				}
+
+				if diff := result.RetryAfter - step.wantRetry; diff < -time.Millisecond || diff > time.Millisecond {
+					t.Fatalf("step %d: got retry after %s, want %s", i, result.RetryAfter, step.wantRetry)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryStoreKeysAreIndependent(t *testing.T) {
+	ctx := context.Background()
+	limit := Limit{Burst: 1, Period: time.Minute}
+	store, _ := newTestMemoryStore()
+
+	if result, _ := store.Take(ctx, "a", limit); !result.Allowed {
+		t.Fatal("first request for a was denied")
+	}
+
+	if result, _ := store.Take(ctx, "a", limit); result.Allowed {
+		t.Fatal("second request for a was allowed")
+	}
+
+	if result, _ := store.Take(ctx, "b", limit); !result.Allowed {
+		t.Fatal("first request for b was denied")
+	}
+}
+
+func TestMemoryStoreSweepsFullBuckets(t *testing.T) {
+	ctx := context.Background()
+	limit := Limit{Burst: 2, Period: time.Second}
+	store, clock := newTestMemoryStore()
+
+	store.Take(ctx, "key", limit)
+	clock.Advance(sweepInterval)
+	store.Take(ctx, "other", limit)
+
+	if _, ok := store.buckets["key"]; ok {
+		t.Error("refilled bucket was not swept")
+	}
+
+	if _, ok := store.buckets["other"]; !ok {
+		t.Error("bucket in use was swept")
+	}
+}
@@ -0,0 +1,59 @@
+// Package ratelimit implements token bucket rate limiting with pluggable storage, so limits can be
+// kept in memory for a single instance or shared between replicas through Redis.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows bursts of up to Burst requests, refilled at Burst requests per Period.
+type Limit struct {
+	Burst  int
+	Period time.Duration
+}
+
+// ratePerSecond is how many tokens are added to a bucket per second.
+func (l Limit) ratePerSecond() float64 {
+	return float64(l.Burst) / l.Period.Seconds()
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Burst, l.Period)
+}
+
+// ParseLimit parses limits written as "<requests>/<period>", for example "10/1m" or "100/1h".
+func ParseLimit(text string) (Limit, error) {
+	burstText, periodText, found := strings.Cut(strings.TrimSpace(text), "/")
+	if !found {
+		return Limit{}, fmt.Errorf("rate limit %q must be <requests>/<period>", text)
+	}
+
+	burst, err := strconv.Atoi(burstText)
+	if err != nil || burst < 1 {
+		return Limit{}, fmt.Errorf("rate limit %q must allow at least one request", text)
+	}
+
+	period, err := time.ParseDuration(periodText)
+	if err != nil || period <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q has an invalid period", text)
+	}
+
+	return Limit{Burst: burst, Period: period}, nil
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// How long until a token is available again, set when the request is not allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps token buckets. Take must be atomic per key, since concurrent requests share buckets.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
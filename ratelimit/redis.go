@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RedisClient is the subset of a Redis client the RedisStore needs. RESPClient implements it, and
+// so can a thin adapter over any client library, for example with go-redis:
+//
+//	func (a adapter) Eval(ctx context.Context, script string, keys []string, args ...any) (any, error) {
+//		return a.client.Eval(ctx, script, keys, args...).Result()
+//	}
+type RedisClient interface {
+	Eval(ctx context.Context, script string, keys []string, args ...any) (any, error)
+}
+
+// takeScript refills and takes from a bucket atomically, using the Redis clock so replicas with
+// skewed clocks share consistent buckets. Returns {allowed, remaining, retry after in ms}.
+const takeScript = `
+local burst = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1]) or burst
+local updated = tonumber(state[2]) or now
+
+tokens = math.min(burst, tokens + math.max(0, now - updated) * rate)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) / rate)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate) + 1000)
+
+return {allowed, math.floor(tokens), retry}
+`
+
+// RedisStore keeps buckets in Redis, or any server speaking its protocol and scripting, so every
+// replica shares the same limits.
+type RedisStore struct {
+	client RedisClient
+	prefix string
+}
+
+// NewRedisStore creates a store whose bucket keys are namespaced with prefix.
+func NewRedisStore(client RedisClient, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	// Tokens per millisecond, matching the Redis clock resolution used by the script
+	rate := limit.ratePerSecond() / 1000
+
+	reply, err := s.client.Eval(ctx, takeScript, []string{s.prefix + key}, limit.Burst, rate)
+	if err != nil {
+		return Result{}, err
+	}
+
+	values, ok := reply.([]any)
+	if !ok || len(values) != 3 {
+		return Result{}, fmt.Errorf("unexpected rate limit script reply %v", reply)
+	}
+
+	numbers := make([]int64, len(values))
+	for i, value := range values {
+		number, ok := value.(int64)
+		if !ok {
+			return Result{}, fmt.Errorf("unexpected rate limit script reply %v", reply)
+		}
+		numbers[i] = number
+	}
+
+	return Result{
+		Allowed:    numbers[0] == 1,
+		Remaining:  int(numbers[1]),
+		RetryAfter: time.Duration(numbers[2]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,240 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// DefaultRedisTimeout bounds a command when the caller's context carries no deadline.
+const DefaultRedisTimeout = 2 * time.Second
+
+// RedisError is an error reply sent by the server.
+type RedisError string
+
+func (e RedisError) Error() string {
+	return string(e)
+}
+
+// RESPClient is a minimal RedisClient speaking the Redis protocol directly, enough for the
+// RedisStore without pulling in a client library. Connections are pooled and reused.
+type RESPClient struct {
+	addr     string
+	password string
+	db       int
+	idle     chan *respConn
+}
+
+type respConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewRESPClient creates a client for the server at addr. The password is sent with AUTH and db
+// is selected when not 0. At most maxIdle connections are kept open between commands.
+func NewRESPClient(addr string, password string, db int, maxIdle int) *RESPClient {
+	return &RESPClient{
+		addr:     addr,
+		password: password,
+		db:       db,
+		idle:     make(chan *respConn, maxIdle),
+	}
+}
+
+// Ping checks that the server is reachable and accepts the credentials.
+func (c *RESPClient) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+	return err
+}
+
+func (c *RESPClient) Eval(ctx context.Context, script string, keys []string, args ...any) (any, error) {
+	command := make([]any, 0, 3+len(keys)+len(args))
+	command = append(command, "EVAL", script, len(keys))
+	for _, key := range keys {
+		command = append(command, key)
+	}
+	command = append(command, args...)
+
+	return c.Do(ctx, command...)
+}
+
+// Do sends a command and returns its reply as a string, int64, []any or nil. Error replies are
+// returned as a RedisError.
+func (c *RESPClient) Do(ctx context.Context, args ...any) (any, error) {
+	rc, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := rc.do(ctx, args)
+
+	var redisErr RedisError
+	if err != nil && !errors.As(err, &redisErr) {
+		// The connection state is unknown after an I/O error
+		rc.conn.Close()
+		return nil, err
+	}
+
+	c.put(rc)
+	return reply, err
+}
+
+// Close closes the idle connections.
+func (c *RESPClient) Close() error {
+	for {
+		select {
+		case rc := <-c.idle:
+			rc.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *RESPClient) get(ctx context.Context) (*respConn, error) {
+	select {
+	case rc := <-c.idle:
+		return rc, nil
+	default:
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	rc := &respConn{conn: conn, reader: bufio.NewReader(conn)}
+
+	if c.password != "" {
+		if _, err := rc.do(ctx, []any{"AUTH", c.password}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if c.db != 0 {
+		if _, err := rc.do(ctx, []any{"SELECT", c.db}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return rc, nil
+}
+
+func (c *RESPClient) put(rc *respConn) {
+	select {
+	case c.idle <- rc:
+	default:
+		rc.conn.Close()
+	}
+}
+
+func (rc *respConn) do(ctx context.Context, args []any) (any, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(DefaultRedisTimeout)
+	}
+
+	if err := rc.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	// Cancelling ctx expires the deadline, aborting the exchange in flight
+	stop := context.AfterFunc(ctx, func() { rc.conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	if _, err := rc.conn.Write(encodeCommand(args)); err != nil {
+		return nil, err
+	}
+
+	return readReply(rc.reader)
+}
+
+// encodeCommand encodes a command as an array of bulk strings.
+func encodeCommand(args []any) []byte {
+	buf := fmt.Appendf(nil, "*%d\r\n", len(args))
+
+	for _, arg := range args {
+		var value string
+		switch v := arg.(type) {
+		case string:
+			value = v
+		case int:
+			value = strconv.Itoa(v)
+		case int64:
+			value = strconv.FormatInt(v, 10)
+		case float64:
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			value = fmt.Sprint(v)
+		}
+
+		buf = fmt.Appendf(buf, "$%d\r\n%s\r\n", len(value), value)
+	}
+
+	return buf
+}
+
+func readReply(reader *bufio.Reader) (any, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed reply %q", line)
+	}
+
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, RedisError(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(payload)
+		if err != nil || size < 0 {
+			return nil, err
+		}
+
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+
+		return string(data[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(payload)
+		if err != nil || count < 0 {
+			return nil, err
+		}
+
+		values := make([]any, count)
+		for i := range values {
+			// Error elements are kept as values, the reply itself succeeded
+			value, err := readReply(reader)
+			var redisErr RedisError
+			if errors.As(err, &redisErr) {
+				value, err = redisErr, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+
+		return values, nil
+	default:
+		return nil, fmt.Errorf("unknown reply type %q", kind)
+	}
+}
@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    any
+		wantErr error
+	}{
+		{name: "simple string", input: "+OK\r\n", want: "OK"},
+		{name: "empty simple string", input: "+\r\n", want: ""},
+		{name: "error", input: "-ERR unknown command\r\n", wantErr: RedisError("ERR unknown command")},
+		{name: "integer", input: ":42\r\n", want: int64(42)},
+		{name: "negative integer", input: ":-1\r\n", want: int64(-1)},
+		{name: "bulk string", input: "$5\r\nhello\r\n", want: "hello"},
+		{name: "bulk string with CRLF", input: "$7\r\nhel\r\nlo\r\n", want: "hel\r\nlo"},
+		{name: "empty bulk string", input: "$0\r\n\r\n", want: ""},
+		{name: "null bulk string", input: "$-1\r\n", want: nil},
+		{name: "array", input: "*3\r\n:1\r\n:4\r\n:0\r\n", want: []any{int64(1), int64(4), int64(0)}},
+		{name: "empty array", input: "*0\r\n", want: []any{}},
+		{name: "null array", input: "*-1\r\n", want: nil},
+		{
+			name:  "nested array",
+			input: "*2\r\n*1\r\n+a\r\n$-1\r\n",
+			want:  []any{[]any{"a"}, nil},
+		},
+		{
+			name:  "array with error element",
+			input: "*2\r\n-ERR nope\r\n:1\r\n",
+			want:  []any{RedisError("ERR nope"), int64(1)},
+		},
+		{name: "truncated bulk string", input: "$5\r\nhel", wantErr: io.ErrUnexpectedEOF},
+		{name: "truncated array", input: "*2\r\n:1\r\n", wantErr: io.EOF},
+		{name: "missing line", input: "", wantErr: io.EOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readReply(bufio.NewReader(bytes.NewReader([]byte(tt.input))))
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("readReply(%q) error = %v, want %v", tt.input, err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("readReply(%q) returned %v", tt.input, err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("readReply(%q) = %#v, want %#v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadReplyMalformed(t *testing.T) {
+	inputs := []string{
+		"OK\r\n",
+		"+OK\n",
+		":abc\r\n",
+		"$abc\r\n",
+		"*abc\r\n",
+	}
+
+	for _, input := range inputs {
+		if _, err := readReply(bufio.NewReader(bytes.NewReader([]byte(input)))); err == nil {
+			t.Errorf("readReply(%q) returned no error", input)
+		}
+	}
+}
+
+func TestEncodeCommand(t *testing.T) {
+	got := string(encodeCommand([]any{"EVAL", "return 1", 0, int64(7), 0.5}))
+	want := "*5\r\n$4\r\nEVAL\r\n$8\r\nreturn 1\r\n$1\r\n0\r\n$1\r\n7\r\n$3\r\n0.5\r\n"
+
+	if got != want {
+		t.Errorf("encodeCommand = %q, want %q", got, want)
+	}
+}
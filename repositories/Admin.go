@@ -0,0 +1,214 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"santiagotorres.me/user-service/logger"
+	"santiagotorres.me/user-service/models"
+	"santiagotorres.me/user-service/services"
+)
+
+// MaxUserPageSize caps how many users ListUsers returns per page
+const MaxUserPageSize = 100
+
+// likeEscaper escapes the LIKE wildcards in user supplied search terms
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// ListUsers returns a page of users whose email or name contains query, newest first, along with
+// the total number of matching users. Pages start at 1.
+func ListUsers(query string, page int, pageSize int, db *gorm.DB) ([]models.UserSummary, int64, error) {
+	ctx := context.Background()
+
+	var filter gorm.ChainInterface[models.User] = gorm.G[models.User](db)
+	if query = strings.TrimSpace(query); query != "" {
+		pattern := "%" + likeEscaper.Replace(query) + "%"
+		filter = filter.Where("users.email ILIKE ? OR users.name ILIKE ?", pattern, pattern)
+	}
+
+	total, err := filter.Count(ctx, "*")
+
+	if err != nil {
+		logger.Logger.Error("Error counting users", "err", err.Error())
+		return nil, 0, NewRepositoryError(ErrCodeDatabaseError, "failed to count users", err)
+	}
+
+	users, err := filter.
+		Joins(clause.JoinTarget{Association: "UserTOTP"}, nil).
+		Order("users.created_at DESC, users.user_id").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(ctx)
+
+	if err != nil {
+		logger.Logger.Error("Error listing users", "err", err.Error())
+		return nil, 0, NewRepositoryError(ErrCodeDatabaseError, "failed to list users", err)
+	}
+
+	summaries := make([]models.UserSummary, len(users))
+	for i := range users {
+		summaries[i] = models.NewUserSummary(&users[i])
+	}
+
+	return summaries, total, nil
+}
+
+// GetUserDetail returns a user with their roles, TOTP status and active sessions.
+func GetUserDetail(userID uuid.UUID, db *gorm.DB) (*models.UserDetail, error) {
+	ctx := context.Background()
+
+	user, err := GetUser(userID, db)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := ListActiveSessions(userID, uuid.Nil, db)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := GetUserRoleNames(userID, db)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, err := gorm.G[models.UserRecoveryCode](db).Where("user_id = ? AND used_at IS NULL", userID).Count(ctx, "*")
+
+	if err != nil {
+		logger.Logger.Error("Error counting recovery codes", "err", err.Error())
+		return nil, NewRepositoryError(ErrCodeDatabaseError, "failed to count recovery codes", err)
+	}
+
+	return &models.UserDetail{
+		UserSummary:            models.NewUserSummary(user),
+		Roles:                  roles,
+		RecoveryCodesRemaining: int(recoveryCodes),
+		Sessions:               sessions,
+	}, nil
+}
+
+// SetUserDisabled disables or re-enables a user. Disabling also revokes every session of the user.
+func SetUserDisabled(userID uuid.UUID, disabled bool, db *gorm.DB) error {
+	ctx := context.Background()
+
+	var disabledAt *time.Time
+	if disabled {
+		now := time.Now().UTC()
+		disabledAt = &now
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		rowsAffected, err := gorm.G[models.User](tx).Where("user_id = ?", userID).Update(ctx, "disabled_at", disabledAt)
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return ErrUserNotFound
+		}
+
+		if !disabled {
+			return nil
+		}
+
+		_, err = services.RevokeUserSessions(userID, nil, tx)
+		return err
+	})
+
+	if errors.Is(err, ErrUserNotFound) {
+		return ErrUserNotFound
+	}
+
+	if err != nil {
+		logger.Logger.Error("Error updating user disabled state", "userId", userID, "err", err.Error())
+		return NewRepositoryError(ErrCodeDatabaseError, "failed to update user", err)
+	}
+
+	return nil
+}
+
+// ForcePasswordReset revokes every session of the user and refuses logins until the password is
+// reset. The returned password reset token is meant to be emailed to the user.
+func ForcePasswordReset(userID uuid.UUID, db *gorm.DB) (*models.User, string, error) {
+	ctx := context.Background()
+
+	var user models.User
+	var resetToken string
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		user, err = gorm.G[models.User](tx).Where("user_id = ?", userID).First(ctx)
+		if err != nil {
+			return err
+		}
+
+		if _, err := gorm.G[models.User](tx).Where("user_id = ?", userID).Update(ctx, "password_reset_required", true); err != nil {
+			return err
+		}
+
+		if _, err := services.RevokeUserSessions(userID, nil, tx); err != nil {
+			return err
+		}
+
+		resetToken, err = createOneTimeToken(userID, models.PasswordResetPurpose, PasswordResetTokenTTL, tx)
+		return err
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", ErrUserNotFound
+	}
+
+	if err != nil {
+		logger.Logger.Error("Error forcing password reset", "userId", userID, "err", err.Error())
+		return nil, "", NewRepositoryError(ErrCodeDatabaseError, "failed to force password reset", err)
+	}
+
+	user.PasswordResetRequired = true
+
+	return &user, resetToken, nil
+}
+
+// ResetMFA removes the user's TOTP enrollment and recovery codes and revokes every session, for
+// users who lost their authenticator and recovery codes.
+func ResetMFA(userID uuid.UUID, db *gorm.DB) error {
+	if _, err := GetUser(userID, db); err != nil {
+		return err
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := deleteTOTPEnrollment(userID, tx); err != nil {
+			return err
+		}
+
+		_, err := services.RevokeUserSessions(userID, nil, tx)
+		return err
+	})
+
+	if err != nil {
+		logger.Logger.Error("Error resetting MFA", "userId", userID, "err", err.Error())
+		return NewRepositoryError(ErrCodeDatabaseError, "failed to reset MFA", err)
+	}
+
+	return nil
+}
+
+// RevokeAllUserSessions revokes every active session of the user and returns how many were revoked.
+func RevokeAllUserSessions(userID uuid.UUID, db *gorm.DB) (int, error) {
+	if _, err := GetUser(userID, db); err != nil {
+		return 0, err
+	}
+
+	revoked, err := services.RevokeUserSessions(userID, nil, db)
+
+	if err != nil {
+		logger.Logger.Error("Error revoking user sessions", "userId", userID, "err", err.Error())
+		return 0, NewRepositoryError(ErrCodeDatabaseError, "failed to revoke sessions", err)
+	}
+
+	return revoked, nil
+}
@@ -0,0 +1,186 @@
+package repositories
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"santiagotorres.me/user-service/logger"
+	"santiagotorres.me/user-service/models"
+)
+
+const (
+	// AccountLockoutThreshold is how many consecutive failures lock an account
+	AccountLockoutThreshold = 5
+	// IPLockoutThreshold is how many failures lock a client IP, across every account it tries
+	IPLockoutThreshold = 20
+	// LockoutBaseDelay is the first lockout, doubled with every further failure
+	LockoutBaseDelay = 30 * time.Second
+	LockoutMaxDelay  = 15 * time.Minute
+	// FailureWindow is how long failures are remembered after the last one
+	FailureWindow = time.Hour
+)
+
+const (
+	accountLockoutPrefix = "account:"
+	ipLockoutPrefix      = "ip:"
+)
+
+// AccountLockoutKey identifies the failure counter of an account by email, so attempts against
+// unknown emails are throttled the same way as against existing accounts.
+func AccountLockoutKey(email string) string {
+	return accountLockoutPrefix + strings.ToLower(strings.TrimSpace(email))
+}
+
+// IPLockoutKey identifies the failure counter of a client IP.
+func IPLockoutKey(ipAddress string) string {
+	return ipLockoutPrefix + ipAddress
+}
+
+func lockoutKeys(email string, deviceInfo *models.DeviceInfo) []string {
+	keys := []string{AccountLockoutKey(email)}
+	if deviceInfo != nil && deviceInfo.IPAddress != "" {
+		keys = append(keys, IPLockoutKey(deviceInfo.IPAddress))
+	}
+	return keys
+}
+
+// lockoutDelay is how long a key is locked after its failures-th failure, zero below the threshold.
+func lockoutDelay(failures int, threshold int) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+
+	delay := LockoutBaseDelay
+	for i := threshold; i < failures && delay < LockoutMaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, LockoutMaxDelay)
+}
+
+// checkLockout returns a LockoutError when any of the keys is currently locked.
+func checkLockout(keys []string, db *gorm.DB) error {
+	now := time.Now().UTC()
+
+	locked, err := gorm.G[models.AuthFailure](db).Where("key IN ? AND locked_until > ?", keys, now).Find(context.Background())
+
+	if err != nil {
+		logger.Logger.Error("Error checking lockout", "err", err.Error())
+		return NewRepositoryError(ErrCodeDatabaseError, "failed to check lockout", err)
+	}
+
+	var retryAfter time.Duration
+	for _, failure := range locked {
+		retryAfter = max(retryAfter, failure.LockedUntil.Sub(now))
+	}
+
+	if retryAfter > 0 {
+		return &LockoutError{RetryAfter: retryAfter}
+	}
+
+	return nil
+}
+
+// recordAuthFailure counts a failed attempt against every key, locking the ones past their threshold.
+// Errors are only logged so they never mask the original authentication failure.
+func recordAuthFailure(keys []string, db *gorm.DB) {
+	ctx := context.Background()
+
+	for _, key := range keys {
+		threshold := AccountLockoutThreshold
+		if strings.HasPrefix(key, ipLockoutPrefix) {
+			threshold = IPLockoutThreshold
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			now := time.Now().UTC()
+			windowStart := now.Add(-FailureWindow)
+
+			// Failures older than the window are forgotten and counting starts again
+			upsert := clause.OnConflict{
+				Columns: []clause.Column{{Name: "key"}},
+				DoUpdates: clause.Assignments(map[string]any{
+					"failures":        gorm.Expr("CASE WHEN auth_failures.last_failure_at < ? THEN 1 ELSE auth_failures.failures + 1 END", windowStart),
+					"last_failure_at": now,
+				}),
+			}
+
+			if err := gorm.G[models.AuthFailure](tx, upsert).Create(ctx, &models.AuthFailure{Key: key, Failures: 1, LastFailureAt: now}); err != nil {
+				return err
+			}
+
+			failure, err := gorm.G[models.AuthFailure](tx).Where("key = ?", key).First(ctx)
+			if err != nil {
+				return err
+			}
+
+			delay := lockoutDelay(failure.Failures, threshold)
+			if delay == 0 {
+				return nil
+			}
+
+			lockedUntil := now.Add(delay)
+			logger.Logger.Warn("Locking out after repeated failures", "key", key, "failures", failure.Failures, "lockedUntil", lockedUntil)
+
+			_, err = gorm.G[models.AuthFailure](tx).Where("key = ?", key).Update(ctx, "locked_until", lockedUntil)
+			return err
+		})
+
+		if err != nil {
+			logger.Logger.Error("Error recording authentication failure", "key", key, "err", err.Error())
+		}
+	}
+}
+
+// clearAuthFailures forgets the failures of an account after a successful authentication.
+// The IP counter is kept so a single valid account cannot be used to reset it.
+func clearAuthFailures(email string, db *gorm.DB) {
+	if _, err := gorm.G[models.AuthFailure](db).Where("key = ?", AccountLockoutKey(email)).Delete(context.Background()); err != nil {
+		logger.Logger.Error("Error clearing authentication failures", "err", err.Error())
+	}
+}
+
+// Unlock removes the failure counter and lockout of an account or IP key.
+func Unlock(key string, db *gorm.DB) (int, error) {
+	rowsAffected, err := gorm.G[models.AuthFailure](db).Where("key = ?", key).Delete(context.Background())
+
+	if err != nil {
+		logger.Logger.Error("Error unlocking", "key", key, "err", err.Error())
+		return 0, NewRepositoryError(ErrCodeDatabaseError, "failed to unlock", err)
+	}
+
+	if rowsAffected > 0 {
+		logger.Logger.Info("Unlocked", "key", key)
+	}
+
+	return rowsAffected, nil
+}
+
+// ListLockouts returns the accounts and IPs that are currently locked.
+func ListLockouts(db *gorm.DB) ([]models.AuthFailure, error) {
+	lockouts, err := gorm.G[models.AuthFailure](db).Where("locked_until > ?", time.Now().UTC()).Order("locked_until DESC").Find(context.Background())
+
+	if err != nil {
+		return nil, NewRepositoryError(ErrCodeDatabaseError, "failed to list lockouts", err)
+	}
+
+	return lockouts, nil
+}
+
+// PruneAuthFailures deletes failure counters that are no longer locked and fell out of the failure window.
+func PruneAuthFailures(db *gorm.DB) (int, error) {
+	now := time.Now().UTC()
+
+	rowsAffected, err := gorm.G[models.AuthFailure](db).
+		Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", now.Add(-FailureWindow), now).
+		Delete(context.Background())
+
+	if err != nil {
+		return 0, NewRepositoryError(ErrCodeDatabaseError, "failed to prune authentication failures", err)
+	}
+
+	return rowsAffected, nil
+}
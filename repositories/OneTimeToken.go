@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"santiagotorres.me/user-service/logger"
+	"santiagotorres.me/user-service/models"
+	"santiagotorres.me/user-service/utils"
+)
+
+// createOneTimeToken stores the hash of a new random token for the user and returns the plain token.
+func createOneTimeToken(userID uuid.UUID, purpose string, ttl time.Duration, db *gorm.DB) (string, error) {
+	token, err := utils.GenerateRandomToken()
+
+	if err != nil {
+		logger.Logger.Error("Error generating one time token", "purpose", purpose, "err", err.Error())
+		return "", NewRepositoryError(ErrCodeTokenGenerationError, "failed to generate one time token", err)
+	}
+
+	oneTimeToken := models.OneTimeToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: utils.HashSHA256(token),
+		ExpiresAt: time.Now().UTC().Add(ttl),
+	}
+
+	ctx := context.Background()
+	if err := gorm.G[models.OneTimeToken](db).Create(ctx, &oneTimeToken); err != nil {
+		logger.Logger.Error("Error saving one time token", "purpose", purpose, "err", err.Error())
+		return "", NewRepositoryError(ErrCodeDatabaseError, "failed to save one time token", err)
+	}
+
+	return token, nil
+}
+
+// consumeOneTimeToken marks a valid token as used, along with every other outstanding token
+// of the same user and purpose. The conditional update makes concurrent redemptions fail.
+func consumeOneTimeToken(token string, purpose string, tx *gorm.DB) (*models.OneTimeToken, error) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	oneTimeToken, err := gorm.G[models.OneTimeToken](tx).
+		Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", utils.HashSHA256(token), purpose, now).
+		First(ctx)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.Logger.Warn("Invalid or expired one time token", "purpose", purpose)
+		return nil, ErrInvalidToken
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := gorm.G[models.OneTimeToken](tx).
+		Where("one_time_token_id = ? AND used_at IS NULL", oneTimeToken.OneTimeTokenID).
+		Update(ctx, "used_at", now)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	if _, err := gorm.G[models.OneTimeToken](tx).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", oneTimeToken.UserID, purpose).
+		Update(ctx, "used_at", now); err != nil {
+		return nil, err
+	}
+
+	return &oneTimeToken, nil
+}
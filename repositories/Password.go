@@ -0,0 +1,32 @@
+package repositories
+
+import (
+	"santiagotorres.me/user-service/logger"
+	"santiagotorres.me/user-service/models"
+	"santiagotorres.me/user-service/utils"
+)
+
+// validatePassword checks a new password for the user against the password policy.
+// An unreadable breach list does not block the user, the remaining rules still apply.
+func validatePassword(password string, user *models.User, policy *utils.PasswordPolicy) error {
+	violations, err := policy.Check(password, user.Email, user.Name)
+
+	if err != nil {
+		logger.Logger.Error("Error checking password against breach list", "err", err.Error())
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	fields := make([]FieldError, len(violations))
+	for i, violation := range violations {
+		fields[i] = FieldError{
+			Field:   "password",
+			Code:    violation.Code,
+			Message: violation.Message,
+		}
+	}
+
+	return &ValidationError{Fields: fields}
+}
@@ -0,0 +1,123 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"santiagotorres.me/user-service/logger"
+	"santiagotorres.me/user-service/models"
+)
+
+// userRoleIDsQuery selects the IDs of the roles granted to a user.
+const userRoleIDsQuery = "SELECT role_id FROM user_roles WHERE user_id = ?"
+
+// GetUserRoleNames returns the names of the roles granted to the user, sorted by name.
+func GetUserRoleNames(userID uuid.UUID, db *gorm.DB) ([]string, error) {
+	roles, err := gorm.G[models.Role](db).
+		Where("role_id IN ("+userRoleIDsQuery+")", userID).
+		Order("name").
+		Find(context.Background())
+
+	if err != nil {
+		logger.Logger.Error("Error loading user roles", "userId", userID, "err", err.Error())
+		return nil, NewRepositoryError(ErrCodeDatabaseError, "failed to load user roles", err)
+	}
+
+	names := make([]string, len(roles))
+	for i, role := range roles {
+		names[i] = role.Name
+	}
+
+	return names, nil
+}
+
+// GetUserPermissions returns the names of every permission granted to the user through their roles.
+func GetUserPermissions(userID uuid.UUID, db *gorm.DB) ([]string, error) {
+	permissions, err := gorm.G[models.Permission](db).
+		Where("permission_id IN (SELECT permission_id FROM role_permissions WHERE role_id IN ("+userRoleIDsQuery+"))", userID).
+		Find(context.Background())
+
+	if err != nil {
+		logger.Logger.Error("Error loading user permissions", "userId", userID, "err", err.Error())
+		return nil, NewRepositoryError(ErrCodeDatabaseError, "failed to load user permissions", err)
+	}
+
+	names := make([]string, len(permissions))
+	for i, permission := range permissions {
+		names[i] = permission.Name
+	}
+
+	return names, nil
+}
+
+// ListRoles returns every role with its permissions.
+func ListRoles(db *gorm.DB) ([]models.Role, error) {
+	roles, err := gorm.G[models.Role](db).Preload("Permissions", nil).Order("name").Find(context.Background())
+
+	if err != nil {
+		return nil, NewRepositoryError(ErrCodeDatabaseError, "failed to list roles", err)
+	}
+
+	return roles, nil
+}
+
+// AssignRole grants a role to the user. Tokens issued from then on carry the role, while
+// permissions are checked against the database and apply immediately.
+func AssignRole(userID uuid.UUID, roleName string, db *gorm.DB) error {
+	user, role, err := findUserAndRole(userID, roleName, db)
+	if err != nil {
+		return err
+	}
+
+	if err := db.Model(user).Association("Roles").Append(role); err != nil {
+		logger.Logger.Error("Error assigning role", "userId", userID, "role", roleName, "err", err.Error())
+		return NewRepositoryError(ErrCodeDatabaseError, "failed to assign role", err)
+	}
+
+	logger.Logger.Info("Role assigned", "userId", userID, "role", roleName)
+	return nil
+}
+
+// RemoveRole takes a role away from the user.
+func RemoveRole(userID uuid.UUID, roleName string, db *gorm.DB) error {
+	user, role, err := findUserAndRole(userID, roleName, db)
+	if err != nil {
+		return err
+	}
+
+	if err := db.Model(user).Association("Roles").Delete(role); err != nil {
+		logger.Logger.Error("Error removing role", "userId", userID, "role", roleName, "err", err.Error())
+		return NewRepositoryError(ErrCodeDatabaseError, "failed to remove role", err)
+	}
+
+	logger.Logger.Info("Role removed", "userId", userID, "role", roleName)
+	return nil
+}
+
+func findUserAndRole(userID uuid.UUID, roleName string, db *gorm.DB) (*models.User, *models.Role, error) {
+	ctx := context.Background()
+
+	user, err := gorm.G[models.User](db).Where("user_id = ?", userID).First(ctx)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrUserNotFound
+	}
+
+	if err != nil {
+		return nil, nil, NewRepositoryError(ErrCodeDatabaseError, "failed to find user", err)
+	}
+
+	role, err := gorm.G[models.Role](db).Where("name = ?", roleName).First(ctx)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrRoleNotFound
+	}
+
+	if err != nil {
+		return nil, nil, NewRepositoryError(ErrCodeDatabaseError, "failed to find role", err)
+	}
+
+	return &user, &role, nil
+}
@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"santiagotorres.me/user-service/logger"
+	"santiagotorres.me/user-service/models"
+	"santiagotorres.me/user-service/services"
+)
+
+// ListActiveSessions returns the non revoked, unexpired sessions of a user, newest first.
+// The session identified by currentSessionID is flagged as the current one.
+func ListActiveSessions(userID uuid.UUID, currentSessionID uuid.UUID, db *gorm.DB) ([]models.SessionInfo, error) {
+	ctx := context.Background()
+
+	userSessions, err := gorm.G[models.UserSessions](db).Where("user_id = ? AND is_revoked = ? AND expires_at > ?", userID, false, time.Now()).Order("created_at DESC").Find(ctx)
+
+	if err != nil {
+		logger.Logger.Error("Error listing user sessions", "err", err.Error())
+		return nil, NewRepositoryError(ErrCodeDatabaseError, "failed to list user sessions", err)
+	}
+
+	sessions := make([]models.SessionInfo, 0, len(userSessions))
+
+	for _, userSession := range userSessions {
+		var deviceInfo models.DeviceInfo
+
+		if len(userSession.DeviceInfo) > 0 {
+			if err := json.Unmarshal(userSession.DeviceInfo, &deviceInfo); err != nil {
+				logger.Logger.Warn("Error parsing session device info", "sessionId", userSession.UserSessionsID, "err", err.Error())
+			}
+		}
+
+		sessions = append(sessions, models.SessionInfo{
+			SessionID:  userSession.UserSessionsID,
+			DeviceInfo: deviceInfo,
+			CreatedAt:  userSession.CreatedAt,
+			ExpiresAt:  userSession.ExpiresAt,
+			Current:    userSession.UserSessionsID == currentSessionID,
+		})
+	}
+
+	return sessions, nil
+}
+
+// RevokeSessionForUser revokes one of the user's sessions by its ID.
+func RevokeSessionForUser(userID uuid.UUID, sessionID uuid.UUID, db *gorm.DB) error {
+	ctx := context.Background()
+
+	userSession, err := gorm.G[models.UserSessions](db).Where("user_id = ? AND user_sessions_id = ? AND is_revoked = ?", userID, sessionID, false).First(ctx)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrSessionNotFound
+	}
+
+	if err != nil {
+		logger.Logger.Error("Error finding user session", "err", err.Error())
+		return NewRepositoryError(ErrCodeDatabaseError, "failed to find user session", err)
+	}
+
+	if err := services.RevokeSession(userSession.UserSessionsID, db); err != nil {
+		return NewRepositoryError(ErrCodeDatabaseError, "failed to revoke session", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,315 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"santiagotorres.me/user-service/logger"
+	"santiagotorres.me/user-service/models"
+	"santiagotorres.me/user-service/utils"
+)
+
+const (
+	totpPeriod = 30
+	totpSkew   = 1
+)
+
+// matchTOTPStep returns the time step the code was generated for, allowing one step of clock skew.
+func matchTOTPStep(code string, secret string, now time.Time) (int64, bool) {
+	currentStep := now.Unix() / totpPeriod
+
+	for offset := int64(-totpSkew); offset <= totpSkew; offset++ {
+		step := currentStep + offset
+
+		valid, err := totp.ValidateCustom(code, secret, time.Unix(step*totpPeriod, 0).UTC(), totp.ValidateOpts{
+			Period:    totpPeriod,
+			Skew:      0,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+
+		if err == nil && valid {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// consumeTOTPCode validates a code against the secret and records its time step in LastUsedAt.
+// The update only succeeds if no code from the same or a later step was accepted before, so a code
+// cannot be replayed within its validity window, even by two concurrent requests.
+func consumeTOTPCode(userTOTP *models.UserTOTP, code string, secret string, db *gorm.DB) error {
+	step, ok := matchTOTPStep(code, secret, time.Now().UTC())
+
+	if !ok {
+		logger.Logger.Warn("Invalid TOTP code", "userId", userTOTP.UserID)
+		return ErrInvalidTOTPCode
+	}
+
+	stepStartedAt := time.Unix(step*totpPeriod, 0).UTC()
+
+	ctx := context.Background()
+	rowsAffected, err := gorm.G[models.UserTOTP](db).
+		Where("user_totp_id = ? AND (last_used_at IS NULL OR last_used_at < ?)", userTOTP.UserTOTPID, stepStartedAt).
+		Update(ctx, "last_used_at", stepStartedAt)
+
+	if err != nil {
+		logger.Logger.Error("Error recording TOTP code usage", "err", err.Error())
+		return NewRepositoryError(ErrCodeDatabaseError, "failed to record TOTP code usage", err)
+	}
+
+	if rowsAffected == 0 {
+		logger.Logger.Warn("Replayed TOTP code rejected", "userId", userTOTP.UserID)
+		return ErrInvalidTOTPCode
+	}
+
+	userTOTP.LastUsedAt = &stepStartedAt
+
+	return nil
+}
+
+const recoveryCodeCount = 10
+
+// replaceRecoveryCodes deletes the user's recovery codes and stores a new set, returning the plain codes.
+func replaceRecoveryCodes(userID uuid.UUID, tx *gorm.DB) ([]string, error) {
+	ctx := context.Background()
+
+	codes := make([]string, 0, recoveryCodeCount)
+	recoveryCodes := make([]models.UserRecoveryCode, 0, recoveryCodeCount)
+
+	for range recoveryCodeCount {
+		code, err := utils.GenerateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, code)
+		recoveryCodes = append(recoveryCodes, models.UserRecoveryCode{
+			UserID:   userID,
+			CodeHash: utils.HashRecoveryCode(code),
+		})
+	}
+
+	if _, err := gorm.G[models.UserRecoveryCode](tx).Where("user_id = ?", userID).Delete(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := gorm.G[models.UserRecoveryCode](tx).CreateInBatches(ctx, &recoveryCodes, recoveryCodeCount); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes issues a new set of recovery codes, invalidating the previous set.
+// A valid TOTP code is required so a stolen access token alone cannot replace the codes, and
+// invalid codes count towards the same lockout as logins.
+func RegenerateRecoveryCodes(userID uuid.UUID, email string, code string, deviceInfo *models.DeviceInfo, encryptor *utils.EncryptorManager, db *gorm.DB) ([]string, error) {
+	ctx := context.Background()
+
+	keys := lockoutKeys(email, deviceInfo)
+	if err := checkLockout(keys, db); err != nil {
+		return nil, err
+	}
+
+	userTOTP, err := gorm.G[models.UserTOTP](db).Where("user_id = ? AND is_enabled = ?", userID, true).First(ctx)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTOTPNotFound
+	}
+
+	if err != nil {
+		logger.Logger.Error("Error finding TOTP enrollment", "err", err.Error())
+		return nil, NewRepositoryError(ErrCodeDatabaseError, "failed to find TOTP enrollment", err)
+	}
+
+	secret, err := encryptor.DecryptSecret(userTOTP.Secret)
+
+	if err != nil {
+		logger.Logger.Error("Error decrypting TOTP secret", "err", err.Error())
+		return nil, NewRepositoryError(ErrCodeTOTPGenerationError, "failed to decrypt TOTP secret", err)
+	}
+
+	if err := consumeTOTPCode(&userTOTP, code, secret, db); err != nil {
+		if errors.Is(err, ErrInvalidTOTPCode) {
+			recordAuthFailure(keys, db)
+		}
+		return nil, err
+	}
+
+	clearAuthFailures(email, db)
+
+	var codes []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		codes, err = replaceRecoveryCodes(userID, tx)
+		return err
+	})
+
+	if err != nil {
+		logger.Logger.Error("Error regenerating recovery codes", "err", err.Error())
+		return nil, NewRepositoryError(ErrCodeDatabaseError, "failed to regenerate recovery codes", err)
+	}
+
+	return codes, nil
+}
+
+// consumeRecoveryCode marks one of the user's unused recovery codes as used.
+func consumeRecoveryCode(userID uuid.UUID, code string, db *gorm.DB) error {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	rowsAffected, err := gorm.G[models.UserRecoveryCode](db).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, utils.HashRecoveryCode(code)).
+		Update(ctx, "used_at", now)
+
+	if err != nil {
+		logger.Logger.Error("Error consuming recovery code", "err", err.Error())
+		return NewRepositoryError(ErrCodeDatabaseError, "failed to consume recovery code", err)
+	}
+
+	if rowsAffected == 0 {
+		logger.Logger.Warn("Invalid recovery code", "userId", userID)
+		return ErrInvalidRecoveryCode
+	}
+
+	remaining, err := gorm.G[models.UserRecoveryCode](db).Where("user_id = ? AND used_at IS NULL", userID).Count(ctx, "*")
+
+	if err == nil {
+		logger.Logger.Info("Recovery code used", "userId", userID, "remaining", remaining)
+	}
+
+	return nil
+}
+
+// DisableTOTP removes the user's TOTP enrollment and recovery codes after re-authenticating
+// with the current password and either a TOTP code or a recovery code. Failures count towards
+// the same lockout as logins.
+func DisableTOTP(userID uuid.UUID, password string, code string, recoveryCode string, deviceInfo *models.DeviceInfo, encryptor *utils.EncryptorManager, db *gorm.DB) error {
+	ctx := context.Background()
+
+	user, err := gorm.G[models.User](db).Where("users.user_id = ?", userID).Joins(clause.JoinTarget{Association: "UserTOTP"}, nil).First(ctx)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrUserNotFound
+	}
+
+	if err != nil {
+		logger.Logger.Error("Error finding user", "err", err.Error())
+		return NewRepositoryError(ErrCodeDatabaseError, "failed to find user", err)
+	}
+
+	keys := lockoutKeys(user.Email, deviceInfo)
+	if err := checkLockout(keys, db); err != nil {
+		return err
+	}
+
+	if !utils.CheckPasswordHash(password, user.Password) {
+		logger.Logger.Warn("Invalid password while disabling TOTP", "userId", userID)
+		recordAuthFailure(keys, db)
+		return ErrInvalidCredentials
+	}
+
+	if !user.UserTOTP.IsEnabled {
+		return ErrTOTPNotFound
+	}
+
+	if recoveryCode != "" {
+		if err := consumeRecoveryCode(userID, recoveryCode, db); err != nil {
+			if errors.Is(err, ErrInvalidRecoveryCode) {
+				recordAuthFailure(keys, db)
+			}
+			return err
+		}
+	} else {
+		secret, err := encryptor.DecryptSecret(user.UserTOTP.Secret)
+
+		if err != nil {
+			logger.Logger.Error("Error decrypting TOTP secret", "err", err.Error())
+			return NewRepositoryError(ErrCodeTOTPGenerationError, "failed to decrypt TOTP secret", err)
+		}
+
+		if err := consumeTOTPCode(&user.UserTOTP, code, secret, db); err != nil {
+			if errors.Is(err, ErrInvalidTOTPCode) {
+				recordAuthFailure(keys, db)
+			}
+			return err
+		}
+	}
+
+	clearAuthFailures(user.Email, db)
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return deleteTOTPEnrollment(userID, tx)
+	})
+
+	if err != nil {
+		logger.Logger.Error("Error disabling TOTP", "err", err.Error())
+		return NewRepositoryError(ErrCodeDatabaseError, "failed to disable TOTP", err)
+	}
+
+	logger.Logger.Info("TOTP disabled", "userId", userID)
+
+	return nil
+}
+
+// deleteTOTPEnrollment removes the user's TOTP secret and recovery codes.
+func deleteTOTPEnrollment(userID uuid.UUID, tx *gorm.DB) error {
+	ctx := context.Background()
+
+	if _, err := gorm.G[models.UserTOTP](tx).Where("user_id = ?", userID).Delete(ctx); err != nil {
+		return err
+	}
+
+	_, err := gorm.G[models.UserRecoveryCode](tx).Where("user_id = ?", userID).Delete(ctx)
+	return err
+}
+
+// ReencryptTOTPSecrets re-encrypts every TOTP secret that is not encrypted with the newest key,
+// so older encryption keys can be removed afterwards. It returns the number of secrets migrated.
+func ReencryptTOTPSecrets(encryptor *utils.EncryptorManager, db *gorm.DB) (int, error) {
+	ctx := context.Background()
+	migrated := 0
+
+	err := gorm.G[models.UserTOTP](db).Order("user_totp_id").FindInBatches(ctx, 100, func(batch []models.UserTOTP, _ int) error {
+		for _, userTOTP := range batch {
+			if !encryptor.NeedsReencryption(userTOTP.Secret) {
+				continue
+			}
+
+			secret, err := encryptor.DecryptSecret(userTOTP.Secret)
+			if err != nil {
+				return NewRepositoryError(ErrCodeTOTPGenerationError, "failed to decrypt TOTP secret of user "+userTOTP.UserID.String(), err)
+			}
+
+			reencrypted, err := encryptor.EncryptSecret(secret)
+			if err != nil {
+				return NewRepositoryError(ErrCodeTOTPGenerationError, "failed to encrypt TOTP secret", err)
+			}
+
+			// Skip the record if it was re-enrolled while the job was running
+			rowsAffected, err := gorm.G[models.UserTOTP](db).
+				Where("user_totp_id = ? AND secret = ?", userTOTP.UserTOTPID, userTOTP.Secret).
+				Update(ctx, "secret", reencrypted)
+			if err != nil {
+				return NewRepositoryError(ErrCodeDatabaseError, "failed to update TOTP secret", err)
+			}
+
+			migrated += rowsAffected
+		}
+		return nil
+	})
+
+	if err != nil {
+		logger.Logger.Error("Error re-encrypting TOTP secrets", "err", err.Error())
+		return migrated, err
+	}
+
+	return migrated, nil
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/pquerna/otp"
 	"github.com/pquerna/otp/totp"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -15,8 +16,13 @@ import (
 	"santiagotorres.me/user-service/utils"
 )
 
-func CreateUser(user *models.User, db *gorm.DB) (*uuid.UUID, error) {
+// CreateUser registers a new user. The password must satisfy the password policy.
+func CreateUser(user *models.User, passwordPolicy *utils.PasswordPolicy, db *gorm.DB) (*uuid.UUID, error) {
 	ctx := context.Background()
+
+	if err := validatePassword(user.Password, user, passwordPolicy); err != nil {
+		return nil, err
+	}
 	_, err := gorm.G[models.User](db).Where("email = ?", user.Email).First(ctx)
 
 	if err == nil {
@@ -37,7 +43,9 @@ func CreateUser(user *models.User, db *gorm.DB) (*uuid.UUID, error) {
 
 	user.Password = hashedPassword
 
-	createErr := gorm.G[models.User](db).Create(ctx, user)
+	// Only the user row is created, associations are never taken from the caller. The generic API
+	// starts a new session that would drop the Omit
+	createErr := db.WithContext(ctx).Omit(clause.Associations).Create(user).Error
 
 	if createErr != nil {
 		logger.Logger.Error("Error creating user", "err", createErr.Error())
@@ -47,14 +55,23 @@ func CreateUser(user *models.User, db *gorm.DB) (*uuid.UUID, error) {
 	return &user.UserID, nil
 }
 
-// LoginUser logs in a user by email and password.
-func LoginUser(email string, userPassword string, deviceInfo *models.DeviceInfo, db *gorm.DB) (*models.PairToken, error) {
+// LoginUser logs in a user by email and password. When requireVerifiedEmail is set,
+// users that have not verified their email address yet are rejected.
+// Failed attempts are counted per account and per client IP, and a LockoutError is returned
+// while either is locked.
+func LoginUser(email string, userPassword string, requireVerifiedEmail bool, deviceInfo *models.DeviceInfo, tokenService *services.TokenService, db *gorm.DB) (*models.PairToken, error) {
 	ctx := context.Background()
 
+	keys := lockoutKeys(email, deviceInfo)
+	if err := checkLockout(keys, db); err != nil {
+		return nil, err
+	}
+
 	user, err := gorm.G[models.User](db).Where("email = ?", email).Joins(clause.JoinTarget{Association: "UserTOTP"}, nil).First(ctx)
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		logger.Logger.Warn("Login attempt for non-existent user", "email", email)
+		recordAuthFailure(keys, db)
 		return nil, ErrInvalidCredentials
 	}
 
@@ -63,14 +80,44 @@ func LoginUser(email string, userPassword string, deviceInfo *models.DeviceInfo,
 		return nil, NewRepositoryError(ErrCodeDatabaseError, "failed to find user", err)
 	}
 
-	if !utils.CheckPasswordHash(userPassword, user.Password) {
+	passwordMatch, needsRehash := utils.VerifyPassword(userPassword, user.Password)
+
+	if !passwordMatch {
 		logger.Logger.Warn("Invalid password attempt", "email", email)
+		recordAuthFailure(keys, db)
 		return nil, ErrInvalidCredentials
 	}
 
+	if user.DisabledAt != nil {
+		logger.Logger.Warn("Login attempt for disabled user", "email", email)
+		return nil, ErrAccountDisabled
+	}
+
+	if user.PasswordResetRequired {
+		logger.Logger.Warn("Login attempt while a password reset is required", "email", email)
+		return nil, ErrPasswordResetRequired
+	}
+
+	if needsRehash {
+		rehashPassword(&user, userPassword, db)
+	}
+
+	if requireVerifiedEmail && user.EmailVerifiedAt == nil {
+		logger.Logger.Warn("Login attempt with unverified email", "email", email)
+		return nil, ErrEmailNotVerified
+	}
+
+	// With TOTP enabled the failure counter is only cleared once the second factor is verified,
+	// otherwise a correct password would reset the TOTP guesses counted against the account
 	if !user.UserTOTP.IsEnabled {
-		// replace for actual secret
-		token, err := services.GenerateTokenWithSession(&user, deviceInfo, db, "secret")
+		clearAuthFailures(email, db)
+
+		roles, err := GetUserRoleNames(user.UserID, db)
+		if err != nil {
+			return nil, err
+		}
+
+		token, err := tokenService.GenerateTokenWithSession(&user, roles, deviceInfo, db)
 		if err != nil {
 			logger.Logger.Error("Error generating token", "err", err.Error())
 			return nil, NewRepositoryError(ErrCodeTokenGenerationError, "failed to generate access token", err)
@@ -78,8 +125,7 @@ func LoginUser(email string, userPassword string, deviceInfo *models.DeviceInfo,
 		return token, nil
 	}
 
-	// replace for actual secret
-	token, err := services.GenerateTempToken(&user, time.Minute*10, "secret")
+	token, err := tokenService.GenerateTempToken(&user, time.Minute*10)
 
 	if err != nil {
 		logger.Logger.Error("Error generating temp token", "err", err.Error())
@@ -92,7 +138,43 @@ func LoginUser(email string, userPassword string, deviceInfo *models.DeviceInfo,
 	}, nil
 }
 
-func SetUpTOTP(userId uuid.UUID, userEmail string, issuer string, encryptor *utils.EncryptorManager, db *gorm.DB) (string, error) {
+// rehashPassword upgrades a legacy or outdated password hash after the password was verified.
+// Failures are only logged, the old hash keeps working until the next login.
+func rehashPassword(user *models.User, password string, db *gorm.DB) {
+	hashedPassword, err := utils.HashPassword(password)
+
+	if err != nil {
+		logger.Logger.Error("Error rehashing password", "userId", user.UserID, "err", err.Error())
+		return
+	}
+
+	// Only replace the hash that was verified, a concurrent password change wins
+	_, err = gorm.G[models.User](db).Where("user_id = ? AND password = ?", user.UserID, user.Password).Update(context.Background(), "password", hashedPassword)
+
+	if err != nil {
+		logger.Logger.Error("Error saving rehashed password", "userId", user.UserID, "err", err.Error())
+		return
+	}
+
+	user.Password = hashedPassword
+}
+
+// SetUpTOTP starts a TOTP enrollment for the user. The generated secret is stored as pending
+// and only becomes active once a code produced from it is confirmed through ConfirmTOTP.
+func SetUpTOTP(userId uuid.UUID, userEmail string, issuer string, encryptor *utils.EncryptorManager, db *gorm.DB) (*otp.Key, error) {
+	ctx := context.Background()
+
+	enabledCount, err := gorm.G[models.UserTOTP](db).Where("user_id = ? AND is_enabled = ?", userId, true).Count(ctx, "*")
+
+	if err != nil {
+		logger.Logger.Error("Error checking TOTP enrollment", "err", err.Error())
+		return nil, NewRepositoryError(ErrCodeDatabaseError, "failed to check TOTP enrollment", err)
+	}
+
+	if enabledCount > 0 {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
 	totpKey, err := totp.Generate(totp.GenerateOpts{
 		Issuer:      issuer,
 		AccountName: userEmail,
@@ -100,29 +182,113 @@ func SetUpTOTP(userId uuid.UUID, userEmail string, issuer string, encryptor *uti
 
 	if err != nil {
 		logger.Logger.Error("Error generating TOTP key", "err", err.Error())
-		return "", NewRepositoryError(ErrCodeTOTPGenerationError, "failed to generate TOTP key", err)
+		return nil, NewRepositoryError(ErrCodeTOTPGenerationError, "failed to generate TOTP key", err)
 	}
 
 	totpSecret, err := encryptor.EncryptSecret(totpKey.Secret())
 
 	if err != nil {
 		logger.Logger.Error("Error encrypting TOTP secret", "err", err.Error())
-		return "", NewRepositoryError(ErrCodeTOTPGenerationError, "failed to encrypt TOTP secret", err)
+		return nil, NewRepositoryError(ErrCodeTOTPGenerationError, "failed to encrypt TOTP secret", err)
 	}
 
 	totp := models.UserTOTP{
 		UserID:    userId,
 		Secret:    totpSecret,
-		IsEnabled: true,
+		IsEnabled: false,
+	}
+
+	// Re-enrolling replaces the pending or disabled secret instead of adding a second record. The
+	// update is guarded on is_enabled so an enrollment confirmed since the check above is never
+	// overwritten
+	upsert := clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Eq{Column: "user_totps.is_enabled", Value: false}}},
+		DoUpdates: clause.AssignmentColumns([]string{"secret", "is_enabled", "last_used_at", "created_at"}),
 	}
 
+	// The generic API does not report affected rows, which is how a skipped conflict update shows up
+	result := db.WithContext(ctx).Clauses(upsert).Create(&totp)
+
+	if result.Error != nil {
+		logger.Logger.Error("Error saving User TOTP record", "err", result.Error.Error())
+		return nil, NewRepositoryError(ErrCodeTOTPGenerationError, "failed to save User TOTP record", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	return totpKey, nil
+}
+
+// ConfirmTOTP enables the user's pending TOTP enrollment once a valid code for it is provided,
+// returning the initial set of recovery codes. Invalid codes count towards the same lockout as logins.
+func ConfirmTOTP(userId uuid.UUID, email string, code string, deviceInfo *models.DeviceInfo, encryptor *utils.EncryptorManager, db *gorm.DB) ([]string, error) {
 	ctx := context.Background()
-	if err := gorm.G[models.UserTOTP](db).Create(ctx, &totp); err != nil {
-		logger.Logger.Error("Error saving User TOTP record", "err", err.Error())
-		return "", NewRepositoryError(ErrCodeTOTPGenerationError, "failed to save User TOTP record", err)
+
+	keys := lockoutKeys(email, deviceInfo)
+	if err := checkLockout(keys, db); err != nil {
+		return nil, err
 	}
 
-	return totpKey.String(), nil
+	userTOTP, err := gorm.G[models.UserTOTP](db).Where("user_id = ? AND is_enabled = ?", userId, false).First(ctx)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTOTPNotFound
+	}
+
+	if err != nil {
+		logger.Logger.Error("Error finding pending TOTP enrollment", "err", err.Error())
+		return nil, NewRepositoryError(ErrCodeDatabaseError, "failed to find pending TOTP enrollment", err)
+	}
+
+	secret, err := encryptor.DecryptSecret(userTOTP.Secret)
+
+	if err != nil {
+		logger.Logger.Error("Error decrypting TOTP secret", "err", err.Error())
+		return nil, NewRepositoryError(ErrCodeTOTPGenerationError, "failed to decrypt TOTP secret", err)
+	}
+
+	if err := consumeTOTPCode(&userTOTP, code, secret, db); err != nil {
+		if errors.Is(err, ErrInvalidTOTPCode) {
+			recordAuthFailure(keys, db)
+		}
+		return nil, err
+	}
+
+	clearAuthFailures(email, db)
+
+	var recoveryCodes []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Only enable the secret the code was verified against, a concurrent re-enrollment keeps the
+		// record but replaces the secret with one the user has not scanned yet
+		rowsAffected, err := gorm.G[models.UserTOTP](tx).
+			Where("user_totp_id = ? AND secret = ? AND is_enabled = ?", userTOTP.UserTOTPID, userTOTP.Secret, false).
+			Update(ctx, "is_enabled", true)
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return ErrTOTPNotFound
+		}
+
+		recoveryCodes, err = replaceRecoveryCodes(userId, tx)
+		return err
+	})
+
+	if errors.Is(err, ErrTOTPNotFound) {
+		logger.Logger.Warn("TOTP enrollment changed while confirming", "userId", userId)
+		return nil, err
+	}
+
+	if err != nil {
+		logger.Logger.Error("Error enabling TOTP", "err", err.Error())
+		return nil, NewRepositoryError(ErrCodeDatabaseError, "failed to enable TOTP", err)
+	}
+
+	return recoveryCodes, nil
 }
 
 func GetUserSession(rawTokenString string, claims *models.Claims, db *gorm.DB) (*models.UserSessions, error) {
@@ -144,20 +310,338 @@ func GetUserSession(rawTokenString string, claims *models.Claims, db *gorm.DB) (
 	return &userSession, nil
 }
 
+// GetUser returns the user with the given ID along with their TOTP enrollment.
+func GetUser(userID uuid.UUID, db *gorm.DB) (*models.User, error) {
+	user, err := gorm.G[models.User](db).Where("users.user_id = ?", userID).Joins(clause.JoinTarget{Association: "UserTOTP"}, nil).First(context.Background())
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+
+	if err != nil {
+		logger.Logger.Error("Error finding user", "err", err.Error())
+		return nil, NewRepositoryError(ErrCodeDatabaseError, "failed to find user", err)
+	}
+
+	return &user, nil
+}
+
+// GetUserByEmail returns the user with the given email.
+func GetUserByEmail(email string, db *gorm.DB) (*models.User, error) {
+	user, err := gorm.G[models.User](db).Where("email = ?", email).First(context.Background())
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+
+	if err != nil {
+		return nil, NewRepositoryError(ErrCodeDatabaseError, "failed to find user", err)
+	}
+
+	return &user, nil
+}
+
 func ChangeUserEmail() {}
 
 func ChangePassword() {}
 
-func ForgotPassword() {}
+// PasswordResetTokenTTL is how long a password reset token stays valid.
+const PasswordResetTokenTTL = 30 * time.Minute
+
+// ForgotPassword creates a single use password reset token for the user with the given email.
+// Only the hash of the token is stored; the plain token is returned so it can be sent to the user.
+func ForgotPassword(email string, db *gorm.DB) (*models.User, string, error) {
+	ctx := context.Background()
+
+	user, err := gorm.G[models.User](db).Where("email = ?", email).First(ctx)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", ErrUserNotFound
+	}
+
+	if err != nil {
+		logger.Logger.Error("Error finding user", "err", err.Error())
+		return nil, "", NewRepositoryError(ErrCodeDatabaseError, "failed to find user", err)
+	}
+
+	resetToken, err := createOneTimeToken(user.UserID, models.PasswordResetPurpose, PasswordResetTokenTTL, db)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &user, resetToken, nil
+}
 
-func RefreshToken() {}
+// ResetPassword sets a new password using a password reset token. The token and every other
+// outstanding reset token of the user are consumed, and all of the user's sessions are revoked.
+// The new password must satisfy the password policy, otherwise the token stays usable.
+func ResetPassword(resetToken string, newPassword string, passwordPolicy *utils.PasswordPolicy, db *gorm.DB) error {
+	ctx := context.Background()
+
+	var userID uuid.UUID
+	err := db.Transaction(func(tx *gorm.DB) error {
+		oneTimeToken, err := consumeOneTimeToken(resetToken, models.PasswordResetPurpose, tx)
+		if err != nil {
+			return err
+		}
+
+		userID = oneTimeToken.UserID
+
+		user, err := gorm.G[models.User](tx).Where("user_id = ?", userID).First(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := validatePassword(newPassword, &user, passwordPolicy); err != nil {
+			return err
+		}
+
+		hashedPassword, err := utils.HashPassword(newPassword)
+		if err != nil {
+			logger.Logger.Error("Error hashing password", "err", err.Error())
+			return NewRepositoryError(ErrCodeHashingError, "failed to hash password", err)
+		}
+
+		now := time.Now().UTC()
+
+		if _, err := gorm.G[models.User](tx).Where("user_id = ?", userID).Updates(ctx, models.User{Password: hashedPassword, UpdatedAt: &now}); err != nil {
+			return err
+		}
+
+		// A forced password reset is complete once a new password is set
+		if _, err := gorm.G[models.User](tx).Where("user_id = ?", userID).Update(ctx, "password_reset_required", false); err != nil {
+			return err
+		}
+
+		_, err = services.RevokeUserSessions(userID, nil, tx)
+		return err
+	})
+
+	var repoErr *RepositoryError
+	if errors.Is(err, ErrValidationFailed) || (errors.As(err, &repoErr) && repoErr.Code == ErrCodeHashingError) {
+		return err
+	}
+
+	if errors.Is(err, ErrInvalidToken) {
+		return ErrInvalidToken
+	}
+
+	if err != nil {
+		logger.Logger.Error("Error resetting password", "err", err.Error())
+		return NewRepositoryError(ErrCodeDatabaseError, "failed to reset password", err)
+	}
+
+	logger.Logger.Info("Password reset", "userId", userID)
+
+	return nil
+}
+
+// RefreshToken redeems a refresh token for a new token pair, rotating both JTIs of its session.
+func RefreshToken(rawRefreshToken string, claims *models.Claims, tokenService *services.TokenService, db *gorm.DB) (*models.PairToken, error) {
+	if claims.TokenType != models.RefreshToken {
+		logger.Logger.Warn("Non refresh token presented for refresh", "type", claims.TokenType, "userId", claims.UserID)
+		return nil, ErrInvalidToken
+	}
+
+	refreshTokenHash := utils.HashSHA256(rawRefreshToken)
+
+	ctx := context.Background()
+	userSession, err := gorm.G[models.UserSessions](db).Where("user_id = ? AND refresh_token_id = ? AND refresh_token_hash = ?", claims.UserID, claims.ID, refreshTokenHash).First(ctx)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, detectRefreshTokenReuse(claims, db)
+	}
+
+	if err != nil {
+		logger.Logger.Error("Error finding user session", "err", err.Error())
+		return nil, NewRepositoryError(ErrCodeDatabaseError, "failed to find user session", err)
+	}
+
+	if userSession.IsRevoked {
+		return nil, ErrSessionRevoked
+	}
+
+	user, err := gorm.G[models.User](db).Where("user_id = ?", claims.UserID).First(ctx)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+
+	if err != nil {
+		logger.Logger.Error("Error finding user", "err", err.Error())
+		return nil, NewRepositoryError(ErrCodeDatabaseError, "failed to find user", err)
+	}
+
+	roles, err := GetUserRoleNames(user.UserID, db)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := tokenService.RotateSessionTokens(&user, roles, &userSession, db)
+
+	if errors.Is(err, services.ErrSessionRotated) {
+		return nil, detectRefreshTokenReuse(claims, db)
+	}
+
+	if err != nil {
+		logger.Logger.Error("Error rotating session tokens", "err", err.Error())
+		return nil, NewRepositoryError(ErrCodeTokenGenerationError, "failed to rotate session tokens", err)
+	}
+
+	return tokens, nil
+}
+
+// detectRefreshTokenReuse is called when a validly signed refresh token no longer matches its session.
+// If the token belongs to a family that has since been rotated past it, the token was already redeemed
+// once, so the whole family is revoked since either the legitimate client or an attacker holds a copy.
+func detectRefreshTokenReuse(claims *models.Claims, db *gorm.DB) error {
+	familyID, err := uuid.Parse(claims.FamilyID)
+
+	if err != nil {
+		logger.Logger.Warn("Refresh token does not match any session", "userId", claims.UserID)
+		return ErrInvalidToken
+	}
+
+	ctx := context.Background()
+	userSession, err := gorm.G[models.UserSessions](db).Where("user_id = ? AND family_id = ?", claims.UserID, familyID).First(ctx)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.Logger.Warn("Refresh token does not match any session", "userId", claims.UserID)
+		return ErrInvalidToken
+	}
+
+	if err != nil {
+		logger.Logger.Error("Error finding session family", "err", err.Error())
+		return NewRepositoryError(ErrCodeDatabaseError, "failed to find session family", err)
+	}
+
+	if userSession.Generation < claims.Generation {
+		logger.Logger.Warn("Refresh token does not match any session", "userId", claims.UserID)
+		return ErrInvalidToken
+	}
+
+	revoked, err := services.RevokeSessionFamily(claims.UserID, familyID, db)
+
+	if err != nil {
+		return NewRepositoryError(ErrCodeDatabaseError, "failed to revoke session family", err)
+	}
+
+	logger.Logger.Warn(
+		"Refresh token reuse detected, session family revoked",
+		"userId", claims.UserID,
+		"familyId", familyID,
+		"presentedGeneration", claims.Generation,
+		"currentGeneration", userSession.Generation,
+		"revokedSessions", revoked,
+	)
+
+	return ErrRefreshTokenReused
+}
 
 func DeleteUser() {}
 
-func LogOutSession() {}
+// LogOutSession revokes the given session, or every session of its user when all is set.
+// With all and keepCurrent set, the given session stays active and only the others are revoked.
+func LogOutSession(userSession *models.UserSessions, all bool, keepCurrent bool, db *gorm.DB) (int, error) {
+	if !all {
+		if err := services.RevokeSession(userSession.UserSessionsID, db); err != nil {
+			return 0, NewRepositoryError(ErrCodeDatabaseError, "failed to revoke session", err)
+		}
+		return 1, nil
+	}
+
+	var exceptSessionID *uuid.UUID
+	if keepCurrent {
+		exceptSessionID = &userSession.UserSessionsID
+	}
+
+	revoked, err := services.RevokeUserSessions(userSession.UserID, exceptSessionID, db)
+	if err != nil {
+		return 0, NewRepositoryError(ErrCodeDatabaseError, "failed to revoke user sessions", err)
+	}
+
+	return revoked, nil
+}
 
 func VerifyJWT() {}
 
 func GenerateTOTP() {}
 
-func VerifyTOTP() {}
+// VerifyTOTP completes a two factor login by exchanging a temp_auth token and either a valid TOTP code
+// or an unused recovery code for a token pair. Invalid codes count towards the same lockout as passwords.
+func VerifyTOTP(claims *models.Claims, code string, recoveryCode string, deviceInfo *models.DeviceInfo, encryptor *utils.EncryptorManager, tokenService *services.TokenService, db *gorm.DB) (*models.PairToken, error) {
+	if claims.TokenType != models.TempAuth {
+		logger.Logger.Warn("Non temp auth token presented for TOTP verification", "type", claims.TokenType, "userId", claims.UserID)
+		return nil, ErrInvalidToken
+	}
+
+	keys := lockoutKeys(claims.Email, deviceInfo)
+	if err := checkLockout(keys, db); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	user, err := gorm.G[models.User](db).Where("users.user_id = ?", claims.UserID).Joins(clause.JoinTarget{Association: "UserTOTP"}, nil).First(ctx)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+
+	if err != nil {
+		logger.Logger.Error("Error finding user", "err", err.Error())
+		return nil, NewRepositoryError(ErrCodeDatabaseError, "failed to find user", err)
+	}
+
+	if user.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+
+	// A reset forced after the temp_auth token was issued must not be bypassed
+	if user.PasswordResetRequired {
+		return nil, ErrPasswordResetRequired
+	}
+
+	if !user.UserTOTP.IsEnabled {
+		return nil, ErrTOTPNotFound
+	}
+
+	if recoveryCode != "" {
+		if err := consumeRecoveryCode(user.UserID, recoveryCode, db); err != nil {
+			if errors.Is(err, ErrInvalidRecoveryCode) {
+				recordAuthFailure(keys, db)
+			}
+			return nil, err
+		}
+	} else {
+		secret, err := encryptor.DecryptSecret(user.UserTOTP.Secret)
+
+		if err != nil {
+			logger.Logger.Error("Error decrypting TOTP secret", "err", err.Error())
+			return nil, NewRepositoryError(ErrCodeTOTPGenerationError, "failed to decrypt TOTP secret", err)
+		}
+
+		if err := consumeTOTPCode(&user.UserTOTP, code, secret, db); err != nil {
+			if errors.Is(err, ErrInvalidTOTPCode) {
+				recordAuthFailure(keys, db)
+			}
+			return nil, err
+		}
+	}
+
+	clearAuthFailures(claims.Email, db)
+
+	roles, err := GetUserRoleNames(user.UserID, db)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := tokenService.GenerateTokenWithSession(&user, roles, deviceInfo, db)
+
+	if err != nil {
+		logger.Logger.Error("Error generating token", "err", err.Error())
+		return nil, NewRepositoryError(ErrCodeTokenGenerationError, "failed to generate access token", err)
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,94 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"santiagotorres.me/user-service/logger"
+	"santiagotorres.me/user-service/models"
+)
+
+const (
+	// EmailVerificationTokenTTL is how long an email verification link stays valid.
+	EmailVerificationTokenTTL = 24 * time.Hour
+	// EmailVerificationResendCooldown is the minimum time between two verification emails to the same user.
+	EmailVerificationResendCooldown = time.Minute
+)
+
+// CreateEmailVerificationToken creates a verification token for the user's email address,
+// refusing to do so while a previous one was issued within the resend cooldown.
+func CreateEmailVerificationToken(user *models.User, db *gorm.DB) (string, error) {
+	if user.EmailVerifiedAt != nil {
+		return "", ErrEmailAlreadyVerified
+	}
+
+	ctx := context.Background()
+	recentCount, err := gorm.G[models.OneTimeToken](db).
+		Where("user_id = ? AND purpose = ? AND created_at > ?", user.UserID, models.EmailVerificationPurpose, time.Now().UTC().Add(-EmailVerificationResendCooldown)).
+		Count(ctx, "*")
+
+	if err != nil {
+		logger.Logger.Error("Error checking verification cooldown", "err", err.Error())
+		return "", NewRepositoryError(ErrCodeDatabaseError, "failed to check verification cooldown", err)
+	}
+
+	if recentCount > 0 {
+		return "", ErrVerificationCooldown
+	}
+
+	return createOneTimeToken(user.UserID, models.EmailVerificationPurpose, EmailVerificationTokenTTL, db)
+}
+
+// ResendEmailVerification creates a new verification token for the user with the given email.
+func ResendEmailVerification(email string, db *gorm.DB) (*models.User, string, error) {
+	ctx := context.Background()
+
+	user, err := gorm.G[models.User](db).Where("email = ?", email).First(ctx)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", ErrUserNotFound
+	}
+
+	if err != nil {
+		logger.Logger.Error("Error finding user", "err", err.Error())
+		return nil, "", NewRepositoryError(ErrCodeDatabaseError, "failed to find user", err)
+	}
+
+	verificationToken, err := CreateEmailVerificationToken(&user, db)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &user, verificationToken, nil
+}
+
+// VerifyEmail consumes an email verification token and marks the user's email as verified.
+func VerifyEmail(verificationToken string, db *gorm.DB) error {
+	ctx := context.Background()
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		oneTimeToken, err := consumeOneTimeToken(verificationToken, models.EmailVerificationPurpose, tx)
+		if err != nil {
+			return err
+		}
+
+		_, err = gorm.G[models.User](tx).
+			Where("user_id = ? AND email_verified_at IS NULL", oneTimeToken.UserID).
+			Update(ctx, "email_verified_at", time.Now().UTC())
+		return err
+	})
+
+	if errors.Is(err, ErrInvalidToken) {
+		return ErrInvalidToken
+	}
+
+	if err != nil {
+		logger.Logger.Error("Error verifying email", "err", err.Error())
+		return NewRepositoryError(ErrCodeDatabaseError, "failed to verify email", err)
+	}
+
+	return nil
+}
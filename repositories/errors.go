@@ -1,6 +1,10 @@
 package repositories
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 // ErrorCode represents different types of repository errors
 type ErrorCode int
@@ -16,6 +20,21 @@ const (
 	ErrCodeTOTPGenerationError
 	ErrCodeInvalidToken
 	ErrCodeTokenExpired
+	ErrCodeSessionRevoked
+	ErrCodeTokenReused
+	ErrCodeSessionNotFound
+	ErrCodeTOTPAlreadyEnabled
+	ErrCodeTOTPNotFound
+	ErrCodeInvalidTOTPCode
+	ErrCodeInvalidRecoveryCode
+	ErrCodeEmailNotVerified
+	ErrCodeEmailAlreadyVerified
+	ErrCodeTooManyRequests
+	ErrCodeValidationFailed
+	ErrCodeAccountLocked
+	ErrCodeRoleNotFound
+	ErrCodeAccountDisabled
+	ErrCodePasswordResetRequired
 )
 
 // RepositoryError represents a custom error type for repository operations
@@ -56,6 +75,49 @@ func NewRepositoryError(code ErrorCode, message string, err error) *RepositoryEr
 	}
 }
 
+// FieldError describes why the value of a single input field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when input fails validation, listing every rejected field
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = fmt.Sprintf("%s %s", field.Field, field.Message)
+	}
+	return "validation failed: " + strings.Join(messages, ", ")
+}
+
+// Is matches ErrValidationFailed
+func (e *ValidationError) Is(target error) bool {
+	t, ok := target.(*RepositoryError)
+	return ok && t.Code == ErrCodeValidationFailed
+}
+
+// LockoutError is returned while too many failed attempts block further authentication attempts
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("too many failed attempts, retry after %s", e.RetryAfter.Round(time.Second))
+}
+
+// Is matches ErrTooManyAttempts
+func (e *LockoutError) Is(target error) bool {
+	t, ok := target.(*RepositoryError)
+	return ok && t.Code == ErrCodeAccountLocked
+}
+
 // Predefined errors
 var (
 	ErrUserAlreadyExists = &RepositoryError{
@@ -72,4 +134,84 @@ var (
 		Code:    ErrCodeInvalidCredentials,
 		Message: "invalid credentials",
 	}
+
+	ErrInvalidToken = &RepositoryError{
+		Code:    ErrCodeInvalidToken,
+		Message: "invalid token",
+	}
+
+	ErrSessionRevoked = &RepositoryError{
+		Code:    ErrCodeSessionRevoked,
+		Message: "session revoked",
+	}
+
+	ErrSessionNotFound = &RepositoryError{
+		Code:    ErrCodeSessionNotFound,
+		Message: "session not found",
+	}
+
+	ErrRefreshTokenReused = &RepositoryError{
+		Code:    ErrCodeTokenReused,
+		Message: "refresh token reused",
+	}
+
+	ErrTOTPAlreadyEnabled = &RepositoryError{
+		Code:    ErrCodeTOTPAlreadyEnabled,
+		Message: "TOTP already enabled",
+	}
+
+	ErrTOTPNotFound = &RepositoryError{
+		Code:    ErrCodeTOTPNotFound,
+		Message: "TOTP enrollment not found",
+	}
+
+	ErrInvalidTOTPCode = &RepositoryError{
+		Code:    ErrCodeInvalidTOTPCode,
+		Message: "invalid TOTP code",
+	}
+
+	ErrInvalidRecoveryCode = &RepositoryError{
+		Code:    ErrCodeInvalidRecoveryCode,
+		Message: "invalid recovery code",
+	}
+
+	ErrEmailNotVerified = &RepositoryError{
+		Code:    ErrCodeEmailNotVerified,
+		Message: "email not verified",
+	}
+
+	ErrEmailAlreadyVerified = &RepositoryError{
+		Code:    ErrCodeEmailAlreadyVerified,
+		Message: "email already verified",
+	}
+
+	ErrVerificationCooldown = &RepositoryError{
+		Code:    ErrCodeTooManyRequests,
+		Message: "verification email sent too recently",
+	}
+
+	ErrValidationFailed = &RepositoryError{
+		Code:    ErrCodeValidationFailed,
+		Message: "validation failed",
+	}
+
+	ErrTooManyAttempts = &RepositoryError{
+		Code:    ErrCodeAccountLocked,
+		Message: "too many failed attempts",
+	}
+
+	ErrRoleNotFound = &RepositoryError{
+		Code:    ErrCodeRoleNotFound,
+		Message: "role not found",
+	}
+
+	ErrAccountDisabled = &RepositoryError{
+		Code:    ErrCodeAccountDisabled,
+		Message: "account disabled",
+	}
+
+	ErrPasswordResetRequired = &RepositoryError{
+		Code:    ErrCodePasswordResetRequired,
+		Message: "password reset required",
+	}
 )
@@ -15,8 +15,56 @@ import (
 	"santiagotorres.me/user-service/utils"
 )
 
+const (
+	AccessTokenTTL  = time.Hour * 24
+	RefreshTokenTTL = time.Hour * 7 * 24
+)
+
+// TokenService signs and validates the JWTs issued by the service.
+type TokenService struct {
+	keyring *Keyring
+}
+
+// NewTokenService creates a token service signing with the active key of the keyring.
+func NewTokenService(keyring *Keyring) (*TokenService, error) {
+	if keyring == nil || keyring.Active() == nil {
+		return nil, errors.New("keyring must have an active signing key")
+	}
+
+	return &TokenService{keyring: keyring}, nil
+}
+
+// sign signs the claims with the active key, setting the kid header so verifiers can pick the right key.
+func (ts *TokenService) sign(claims models.Claims) (string, error) {
+	signingKey := ts.keyring.Active()
+
+	token := jwt.NewWithClaims(signingKey.Method, claims)
+	token.Header["kid"] = signingKey.Kid
+
+	return token.SignedString(signingKey.signKey)
+}
+
+// JWKS returns the public keys tokens can be verified with. Shared secret keys are never published.
+func (ts *TokenService) JWKS() (*JWKSet, error) {
+	jwks := &JWKSet{Keys: []JWK{}}
+
+	for _, signingKey := range ts.keyring.VerificationKeys() {
+		if !signingKey.IsAsymmetric() {
+			continue
+		}
+
+		jwk, err := signingKey.publicJWK()
+		if err != nil {
+			return nil, err
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks, nil
+}
+
 // GenerateTempToken generates a temporary authentication token for TOTP verification.
-func GenerateTempToken(user *models.User, duration time.Duration, jwtSecret string) (string, error) {
+func (ts *TokenService) GenerateTempToken(user *models.User, duration time.Duration) (string, error) {
 	jti := uuid.New().String()
 	now := time.Now().UTC()
 	expiresAt := now.Add(duration)
@@ -35,8 +83,7 @@ func GenerateTempToken(user *models.User, duration time.Duration, jwtSecret stri
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claim)
-	tokenString, err := token.SignedString([]byte(jwtSecret))
+	tokenString, err := ts.sign(claim)
 	if err != nil {
 		logger.Logger.Error("Failed to sign temp token", "error", err)
 		return "", err
@@ -45,19 +92,26 @@ func GenerateTempToken(user *models.User, duration time.Duration, jwtSecret stri
 	return tokenString, nil
 }
 
-// GenerateTokenWithSession generates access and refresh tokens and creates a user session.
-func GenerateTokenWithSession(
-	user *models.User,
-	deviceInfo *models.DeviceInfo,
-	db *gorm.DB,
-	jwtSecret string,
-) (*models.PairToken, error) {
-	ctx := context.Background()
+// ErrSessionRotated is returned when a session no longer holds the refresh token being rotated.
+var ErrSessionRotated = errors.New("session was already rotated or revoked")
+
+type signedTokenPair struct {
+	accessTokenJti     string
+	refreshTokenJti    string
+	accessTokenString  string
+	refreshTokenString string
+	// The session lives as long as its refresh token
+	refreshTokenExpiresAt time.Time
+}
+
+// signTokenPair signs a new access and refresh token for the given user within a session family.
+// The access token carries the user's roles for downstream services.
+func (ts *TokenService) signTokenPair(user *models.User, roles []string, familyID uuid.UUID, generation int) (*signedTokenPair, error) {
 	tokenJti := uuid.New().String()
 	refreshTokenJti := uuid.New().String()
 	now := time.Now().UTC()
-	tokenExpiresAt := now.Add(time.Hour * 24)
-	refreshTokenExpiresAt := now.Add(time.Hour * 7 * 24)
+	tokenExpiresAt := now.Add(AccessTokenTTL)
+	refreshTokenExpiresAt := now.Add(RefreshTokenTTL)
 
 	// Create access token claims
 	accessClaims := models.Claims{
@@ -65,6 +119,9 @@ func GenerateTokenWithSession(
 		Email:        user.Email,
 		TokenType:    models.AccessToken,
 		TOTPVerified: true,
+		FamilyID:     familyID.String(),
+		Generation:   generation,
+		Roles:        roles,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ID:        tokenJti,
 			Subject:   user.UserID.String(),
@@ -80,6 +137,8 @@ func GenerateTokenWithSession(
 		Email:        user.Email,
 		TokenType:    models.RefreshToken,
 		TOTPVerified: true,
+		FamilyID:     familyID.String(),
+		Generation:   generation,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ID:        refreshTokenJti,
 			Subject:   user.UserID.String(),
@@ -90,20 +149,38 @@ func GenerateTokenWithSession(
 	}
 
 	// Sign tokens
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-
-	accessTokenString, accessTokenErr := accessToken.SignedString([]byte(jwtSecret))
-	refreshTokenString, refreshTokenErr := refreshToken.SignedString([]byte(jwtSecret))
+	accessTokenString, accessTokenErr := ts.sign(accessClaims)
+	refreshTokenString, refreshTokenErr := ts.sign(refreshClaims)
 
 	if accessTokenErr != nil || refreshTokenErr != nil {
 		logger.Logger.Error("Failed to sign tokens", "accessTokenError", accessTokenErr, "refreshTokenError", refreshTokenErr)
 		return nil, errors.New("failed to sign tokens")
 	}
 
-	// Hash tokens for storage
-	accessTokenHash := utils.HashSHA256(accessTokenString)
-	refreshTokenHash := utils.HashSHA256(refreshTokenString)
+	return &signedTokenPair{
+		accessTokenJti:        tokenJti,
+		refreshTokenJti:       refreshTokenJti,
+		accessTokenString:     accessTokenString,
+		refreshTokenString:    refreshTokenString,
+		refreshTokenExpiresAt: refreshTokenExpiresAt,
+	}, nil
+}
+
+// GenerateTokenWithSession generates access and refresh tokens and creates a user session.
+// roles are the user's role names, embedded in the access token.
+func (ts *TokenService) GenerateTokenWithSession(
+	user *models.User,
+	roles []string,
+	deviceInfo *models.DeviceInfo,
+	db *gorm.DB,
+) (*models.PairToken, error) {
+	ctx := context.Background()
+	familyID := uuid.New()
+
+	pair, err := ts.signTokenPair(user, roles, familyID, 0)
+	if err != nil {
+		return nil, err
+	}
 
 	// Marshal device info
 	deviceJSON, err := json.Marshal(deviceInfo)
@@ -112,14 +189,16 @@ func GenerateTokenWithSession(
 		return nil, err
 	}
 
-	// Create user session
+	// Create user session, storing only hashes of the tokens
 	userSession := models.UserSessions{
 		UserID:           user.UserID,
-		TokenID:          tokenJti,
-		RefreshTokenID:   refreshTokenJti,
-		TokenHash:        accessTokenHash,
-		RefreshTokenHash: refreshTokenHash,
+		TokenID:          pair.accessTokenJti,
+		RefreshTokenID:   pair.refreshTokenJti,
+		TokenHash:        utils.HashSHA256(pair.accessTokenString),
+		RefreshTokenHash: utils.HashSHA256(pair.refreshTokenString),
+		FamilyID:         familyID,
 		DeviceInfo:       datatypes.JSON(deviceJSON),
+		ExpiresAt:        &pair.refreshTokenExpiresAt,
 	}
 
 	createSessionErr := gorm.G[models.UserSessions](db).Create(ctx, &userSession)
@@ -129,18 +208,96 @@ func GenerateTokenWithSession(
 	}
 
 	return &models.PairToken{
-		AccessToken:  accessTokenString,
-		RefreshToken: refreshTokenString,
+		AccessToken:  pair.accessTokenString,
+		RefreshToken: pair.refreshTokenString,
 	}, nil
 }
 
+// RotateSessionTokens issues a new token pair for an existing session, replacing both JTIs in the same row.
+// The update is conditioned on the current refresh token ID so a refresh token can only be redeemed once.
+func (ts *TokenService) RotateSessionTokens(
+	user *models.User,
+	roles []string,
+	userSession *models.UserSessions,
+	db *gorm.DB,
+) (*models.PairToken, error) {
+	ctx := context.Background()
+	generation := userSession.Generation + 1
+	familyID := userSession.FamilyID
+
+	// Sessions created before token families existed join a family on their first rotation
+	if familyID == uuid.Nil {
+		familyID = uuid.New()
+	}
+
+	pair, err := ts.signTokenPair(user, roles, familyID, generation)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := gorm.G[models.UserSessions](db).
+		Where("user_sessions_id = ? AND refresh_token_id = ? AND is_revoked = ?", userSession.UserSessionsID, userSession.RefreshTokenID, false).
+		Updates(ctx, models.UserSessions{
+			TokenID:          pair.accessTokenJti,
+			RefreshTokenID:   pair.refreshTokenJti,
+			TokenHash:        utils.HashSHA256(pair.accessTokenString),
+			RefreshTokenHash: utils.HashSHA256(pair.refreshTokenString),
+			FamilyID:         familyID,
+			Generation:       generation,
+			ExpiresAt:        &pair.refreshTokenExpiresAt,
+		})
+
+	if err != nil {
+		logger.Logger.Error("Failed to rotate user session", "error", err)
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, ErrSessionRotated
+	}
+
+	return &models.PairToken{
+		AccessToken:  pair.accessTokenString,
+		RefreshToken: pair.refreshTokenString,
+	}, nil
+}
+
+// RevokeSessionFamily revokes every session belonging to the given token family.
+func RevokeSessionFamily(userID uuid.UUID, familyID uuid.UUID, db *gorm.DB) (int, error) {
+	ctx := context.Background()
+
+	rowsAffected, err := gorm.G[models.UserSessions](db).
+		Where("user_id = ? AND family_id = ? AND is_revoked = ?", userID, familyID, false).
+		Update(ctx, "is_revoked", true)
+
+	if err != nil {
+		logger.Logger.Error("Failed to revoke session family", "error", err)
+		return 0, err
+	}
+
+	return rowsAffected, nil
+}
+
 // ValidateToken validates a JWT token and returns the claims.
-func ValidateToken(tokenString string, jwtSecret string) (*jwt.Token, *models.Claims, error) {
+func (ts *TokenService) ValidateToken(tokenString string) (*jwt.Token, *models.Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &models.Claims{}, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		// Tokens issued before kid headers were introduced have none and were signed with the
+		// configured HS256 secret, accepted for as long as that key is not retired
+		kid, ok := token.Header["kid"].(string)
+		if !ok {
+			kid = LegacySigningKid
+		}
+
+		signingKey, ok := ts.keyring.Get(kid)
+		if !ok {
+			return nil, errors.New("unknown signing key")
+		}
+
+		if token.Method.Alg() != signingKey.Method.Alg() {
 			return nil, errors.New("unexpected signing method")
 		}
-		return []byte(jwtSecret), nil
+
+		return signingKey.verifyKey, nil
 	})
 
 	if err != nil {
@@ -154,21 +311,33 @@ func ValidateToken(tokenString string, jwtSecret string) (*jwt.Token, *models.Cl
 	return nil, nil, errors.New("invalid token")
 }
 
-// RevokeSession revokes a user session by token ID.
-//func RevokeSession(tokenID string, db *gorm.DB) error {
-//	ctx := context.Background()
-//
-//	session, err := gorm.G[models.UserSessions](db).Where("token_id = ?", tokenID).First(ctx)
-//	if err != nil {
-//		logger.Logger.Error("Failed to find session", "error", err)
-//		return err
-//	}
-//
-//	deleteErr := gorm.G[models.UserSessions](db).Delete(ctx, session)
-//	if deleteErr != nil {
-//		logger.Logger.Error("Failed to delete session", "error", deleteErr)
-//		return deleteErr
-//	}
-//
-//	return nil
-//}
+// RevokeSession revokes a single user session.
+func RevokeSession(userSessionID uuid.UUID, db *gorm.DB) error {
+	ctx := context.Background()
+
+	_, err := gorm.G[models.UserSessions](db).Where("user_sessions_id = ?", userSessionID).Update(ctx, "is_revoked", true)
+	if err != nil {
+		logger.Logger.Error("Failed to revoke session", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// RevokeUserSessions revokes every active session of a user, optionally keeping one of them alive.
+func RevokeUserSessions(userID uuid.UUID, exceptSessionID *uuid.UUID, db *gorm.DB) (int, error) {
+	ctx := context.Background()
+
+	query := gorm.G[models.UserSessions](db).Where("user_id = ? AND is_revoked = ?", userID, false)
+	if exceptSessionID != nil {
+		query = query.Where("user_sessions_id <> ?", *exceptSessionID)
+	}
+
+	rowsAffected, err := query.Update(ctx, "is_revoked", true)
+	if err != nil {
+		logger.Logger.Error("Failed to revoke user sessions", "error", err)
+		return 0, err
+	}
+
+	return rowsAffected, nil
+}
@@ -0,0 +1,485 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"santiagotorres.me/user-service/logger"
+	"santiagotorres.me/user-service/models"
+	"santiagotorres.me/user-service/utils"
+)
+
+var (
+	ErrSigningKeyNotFound = errors.New("signing key not found")
+	ErrSigningKeyActive   = errors.New("the active signing key cannot be retired")
+)
+
+// Keyring holds the key tokens are signed with and every key tokens may still be verified with.
+// Keyrings backed by the database pick up keys rotated by other replicas on Reload.
+type Keyring struct {
+	mu sync.RWMutex
+	// Keys that sign tokens from a point in time, latest first
+	signers    []scheduledKey
+	keys       map[string]*SigningKey
+	lastReload time.Time
+	db         *gorm.DB
+	encryptor  *utils.EncryptorManager
+}
+
+type scheduledKey struct {
+	key          *SigningKey
+	signingSince time.Time
+}
+
+// minReloadInterval limits reloads triggered by tokens carrying an unknown kid.
+const minReloadInterval = 10 * time.Second
+
+// JWKSMaxAge is how long clients may cache the published JWKS.
+const JWKSMaxAge = 5 * time.Minute
+
+// SigningKeyActivationDelay is how long a rotated key is only published before it signs tokens, so
+// verifiers holding a cached JWKS have fetched it by the time tokens signed with it show up. The
+// extra minute covers replicas reloading their keyring.
+const SigningKeyActivationDelay = JWKSMaxAge + time.Minute
+
+// NewStaticKeyring creates an in memory keyring with a single key, for tools and tests.
+func NewStaticKeyring(signingKey *SigningKey) *Keyring {
+	return &Keyring{
+		signers: []scheduledKey{{key: signingKey}},
+		keys:    map[string]*SigningKey{signingKey.Kid: signingKey},
+	}
+}
+
+// LoadKeyring loads the keyring from the database. On first start the database holds no keys,
+// so the configured seed key is imported as the active key.
+func LoadKeyring(seed *SigningKey, db *gorm.DB, encryptor *utils.EncryptorManager) (*Keyring, error) {
+	keyring := &Keyring{db: db, encryptor: encryptor}
+
+	ctx := context.Background()
+	count, err := gorm.G[models.JWTSigningKey](db).Count(ctx, "*")
+	if err != nil {
+		return nil, err
+	}
+
+	if count == 0 {
+		logger.Logger.Info("Importing configured signing key into the keyring", "kid", seed.Kid, "alg", seed.Method.Alg())
+		if err := storeSigningKey(seed, time.Now().UTC(), db, encryptor); err != nil {
+			return nil, err
+		}
+	} else if err := checkSeedKey(seed, db, encryptor); err != nil {
+		return nil, err
+	}
+
+	if err := keyring.Reload(); err != nil {
+		return nil, err
+	}
+
+	return keyring, nil
+}
+
+// checkSeedKey reports a configured key that differs from the keyring, since the configuration is
+// only imported on first start and later changes to it have no effect. A changed secret under the
+// same kid is refused, tokens would otherwise keep being signed with the stored one.
+func checkSeedKey(seed *SigningKey, db *gorm.DB, encryptor *utils.EncryptorManager) error {
+	storedKey, err := gorm.G[models.JWTSigningKey](db).Where("kid = ?", seed.Kid).First(context.Background())
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.Logger.Warn("Configured signing key is not in the keyring and is ignored, rotate keys with the admin command instead", "kid", seed.Kid, "alg", seed.Method.Alg())
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	storedSigningKey, err := decodeSigningKey(storedKey, encryptor)
+	if err != nil {
+		// Reload skips undecodable keys the same way
+		logger.Logger.Warn("Cannot compare the configured signing key with the keyring", "kid", seed.Kid, "err", err.Error())
+		return nil
+	}
+
+	seedPrivate, err := seed.marshalPrivate()
+	if err != nil {
+		return err
+	}
+
+	storedPrivate, err := storedSigningKey.marshalPrivate()
+	if err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(seedPrivate), []byte(storedPrivate)) != 1 {
+		return fmt.Errorf("configured signing key %s differs from the one in the keyring, rotate keys with the admin command instead of changing it", seed.Kid)
+	}
+
+	return nil
+}
+
+// Reload replaces the in memory keys with the active and not yet retired keys from the database.
+func (k *Keyring) Reload() error {
+	if k.db == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	storedKeys, err := gorm.G[models.JWTSigningKey](k.db).Where("retires_at IS NULL OR retires_at > ?", time.Now().UTC()).Find(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	var signers []scheduledKey
+	keys := make(map[string]*SigningKey, len(storedKeys))
+
+	for _, storedKey := range storedKeys {
+		signingKey, err := decodeSigningKey(storedKey, k.encryptor)
+		if err != nil {
+			logger.Logger.Error("Skipping undecodable signing key", "kid", storedKey.Kid, "err", err.Error())
+			continue
+		}
+
+		keys[signingKey.Kid] = signingKey
+		signers = append(signers, scheduledKey{key: signingKey, signingSince: storedKey.SigningSince()})
+	}
+
+	slices.SortFunc(signers, func(a, b scheduledKey) int {
+		return b.signingSince.Compare(a.signingSince)
+	})
+
+	if !slices.ContainsFunc(signers, func(signer scheduledKey) bool { return !signer.signingSince.After(now) }) {
+		return errors.New("keyring has no active signing key")
+	}
+
+	k.mu.Lock()
+	k.signers = signers
+	k.keys = keys
+	k.lastReload = time.Now()
+	k.mu.Unlock()
+
+	return nil
+}
+
+// Watch reloads the keyring periodically until the context is cancelled.
+func (k *Keyring) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := k.Reload(); err != nil {
+				logger.Logger.Error("Failed to reload signing keyring", "err", err.Error())
+			}
+		}
+	}
+}
+
+// Active returns the key new tokens are signed with: the latest key whose activation has passed.
+func (k *Keyring) Active() *SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	now := time.Now().UTC()
+	for _, signer := range k.signers {
+		if !signer.signingSince.After(now) {
+			return signer.key
+		}
+	}
+
+	// Reload guarantees an activated key, only reachable if the clock went backwards
+	return k.signers[len(k.signers)-1].key
+}
+
+// Get returns the verification key with the given kid. An unknown kid may belong to a key another
+// replica just rotated in, so the keyring is reloaded, at most once per minReloadInterval, before giving up.
+func (k *Keyring) Get(kid string) (*SigningKey, bool) {
+	k.mu.RLock()
+	signingKey, ok := k.keys[kid]
+	canReload := k.db != nil && time.Since(k.lastReload) > minReloadInterval
+	k.mu.RUnlock()
+
+	if ok || !canReload {
+		return signingKey, ok
+	}
+
+	k.mu.Lock()
+	k.lastReload = time.Now()
+	k.mu.Unlock()
+
+	if err := k.Reload(); err != nil {
+		logger.Logger.Error("Failed to reload signing keyring", "err", err.Error())
+		return nil, false
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	signingKey, ok = k.keys[kid]
+	return signingKey, ok
+}
+
+// VerificationKeys returns every key tokens may currently be verified with.
+func (k *Keyring) VerificationKeys() []*SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	keys := make([]*SigningKey, 0, len(k.keys))
+	for _, signingKey := range k.keys {
+		keys = append(keys, signingKey)
+	}
+	return keys
+}
+
+// GenerateSigningKey creates a new random key for the given algorithm.
+func GenerateSigningKey(algorithm string) (*SigningKey, error) {
+	switch algorithm {
+	case jwt.SigningMethodHS256.Alg():
+		secret := make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+			return nil, err
+		}
+		return NewHMACSigningKey(uuid.New().String(), secret)
+	case jwt.SigningMethodRS256.Alg():
+		privateKey, err := rsa.GenerateKey(rand.Reader, 3072)
+		if err != nil {
+			return nil, err
+		}
+		return NewAsymmetricSigningKey(privateKey)
+	case jwt.SigningMethodES256.Alg(), jwt.SigningMethodES384.Alg(), jwt.SigningMethodES512.Alg():
+		curves := map[string]elliptic.Curve{
+			jwt.SigningMethodES256.Alg(): elliptic.P256(),
+			jwt.SigningMethodES384.Alg(): elliptic.P384(),
+			jwt.SigningMethodES512.Alg(): elliptic.P521(),
+		}
+		privateKey, err := ecdsa.GenerateKey(curves[algorithm], rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return NewAsymmetricSigningKey(privateKey)
+	case jwt.SigningMethodEdDSA.Alg():
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return NewAsymmetricSigningKey(privateKey)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+}
+
+// RotateSigningKey generates a new active signing key. The key is published for verification at
+// once and starts signing after SigningKeyActivationDelay, which is returned. The previously active
+// key keeps signing until then and verifying tokens until every token it signed has expired, so
+// rotating does not log anybody out.
+func RotateSigningKey(algorithm string, db *gorm.DB, encryptor *utils.EncryptorManager) (*SigningKey, time.Time, error) {
+	signingKey, err := GenerateSigningKey(algorithm)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	activatesAt := time.Now().UTC().Add(SigningKeyActivationDelay)
+
+	if err := storeSigningKey(signingKey, activatesAt, db, encryptor); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return signingKey, activatesAt, nil
+}
+
+// CurrentSigningKid returns the kid of the key signing tokens at the given time among the stored
+// keys, or an empty string when none is.
+func CurrentSigningKid(keys []models.JWTSigningKey, now time.Time) string {
+	var current *models.JWTSigningKey
+
+	for i, key := range keys {
+		if key.RetiresAt != nil && !key.RetiresAt.After(now) {
+			continue
+		}
+		if key.SigningSince().After(now) {
+			continue
+		}
+		if current == nil || key.SigningSince().After(current.SigningSince()) {
+			current = &keys[i]
+		}
+	}
+
+	if current == nil {
+		return ""
+	}
+	return current.Kid
+}
+
+// RetireSigningKey stops a key that is neither active nor still signing tokens, while the active
+// key is pending, from verifying tokens immediately.
+func RetireSigningKey(kid string, db *gorm.DB) error {
+	ctx := context.Background()
+
+	storedKey, err := gorm.G[models.JWTSigningKey](db).Where("kid = ?", kid).First(ctx)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrSigningKeyNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if storedKey.IsActive {
+		return ErrSigningKeyActive
+	}
+
+	keys, err := ListSigningKeys(db)
+	if err != nil {
+		return err
+	}
+
+	if CurrentSigningKid(keys, time.Now().UTC()) == kid {
+		return ErrSigningKeyActive
+	}
+
+	_, err = gorm.G[models.JWTSigningKey](db).Where("kid = ?", kid).Update(ctx, "retires_at", time.Now().UTC())
+	return err
+}
+
+// ListSigningKeys returns every key of the keyring, including retired ones, newest first.
+func ListSigningKeys(db *gorm.DB) ([]models.JWTSigningKey, error) {
+	ctx := context.Background()
+	return gorm.G[models.JWTSigningKey](db).Order("created_at DESC").Find(ctx)
+}
+
+// storeSigningKey saves the key as the active one signing from activatesAt, scheduling the retirement
+// of the previous active key once the longest lived token it may sign until then has expired.
+func storeSigningKey(signingKey *SigningKey, activatesAt time.Time, db *gorm.DB, encryptor *utils.EncryptorManager) error {
+	privateKey, err := signingKey.marshalPrivate()
+	if err != nil {
+		return err
+	}
+
+	encryptedPrivateKey, err := encryptor.EncryptSecret(privateKey)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	retiresAt := activatesAt.Add(RefreshTokenTTL)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if _, err := gorm.G[models.JWTSigningKey](tx).Where("is_active = ?", true).Updates(ctx, models.JWTSigningKey{RetiresAt: &retiresAt}); err != nil {
+			return err
+		}
+
+		if _, err := gorm.G[models.JWTSigningKey](tx).Where("is_active = ?", true).Update(ctx, "is_active", false); err != nil {
+			return err
+		}
+
+		return gorm.G[models.JWTSigningKey](tx).Create(ctx, &models.JWTSigningKey{
+			Kid:         signingKey.Kid,
+			Algorithm:   signingKey.Method.Alg(),
+			PrivateKey:  encryptedPrivateKey,
+			IsActive:    true,
+			ActivatesAt: &activatesAt,
+		})
+	})
+}
+
+// decodeSigningKey decrypts a stored key.
+func decodeSigningKey(storedKey models.JWTSigningKey, encryptor *utils.EncryptorManager) (*SigningKey, error) {
+	privateKey, err := encryptor.DecryptSecret(storedKey.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if storedKey.Algorithm == jwt.SigningMethodHS256.Alg() {
+		secret, err := base64.StdEncoding.DecodeString(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		return NewHMACSigningKey(storedKey.Kid, secret)
+	}
+
+	signer, err := ParsePrivateKeyPEM([]byte(privateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	signingKey, err := NewAsymmetricSigningKey(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	if signingKey.Kid != storedKey.Kid {
+		return nil, errors.New("stored kid does not match the key thumbprint")
+	}
+
+	return signingKey, nil
+}
+
+// marshalPrivate serializes the private part of the key: base64 for shared secrets, PKCS#8 PEM otherwise.
+func (k *SigningKey) marshalPrivate() (string, error) {
+	if secret, ok := k.signKey.([]byte); ok {
+		return base64.StdEncoding.EncodeToString(secret), nil
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(k.signKey)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// ReencryptSigningKeys re-encrypts every stored private key that is not encrypted with the newest
+// encryption key. It returns the number of keys migrated.
+func ReencryptSigningKeys(encryptor *utils.EncryptorManager, db *gorm.DB) (int, error) {
+	keys, err := ListSigningKeys(db)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx := context.Background()
+	migrated := 0
+
+	for _, key := range keys {
+		if !encryptor.NeedsReencryption(key.PrivateKey) {
+			continue
+		}
+
+		privateKey, err := encryptor.DecryptSecret(key.PrivateKey)
+		if err != nil {
+			return migrated, fmt.Errorf("decrypting signing key %s: %w", key.Kid, err)
+		}
+
+		reencrypted, err := encryptor.EncryptSecret(privateKey)
+		if err != nil {
+			return migrated, err
+		}
+
+		rowsAffected, err := gorm.G[models.JWTSigningKey](db).
+			Where("kid = ? AND private_key = ?", key.Kid, key.PrivateKey).
+			Update(ctx, "private_key", reencrypted)
+		if err != nil {
+			return migrated, err
+		}
+
+		migrated += rowsAffected
+	}
+
+	return migrated, nil
+}
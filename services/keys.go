@@ -0,0 +1,257 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is a key tokens are signed and verified with, identified by the kid token header.
+type SigningKey struct {
+	Kid       string
+	Method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+}
+
+// JWK is the public part of a signing key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LegacySigningKid is the kid of the configured HS256 secret, the key tokens issued before kid
+// headers were introduced were signed with.
+const LegacySigningKid = "hs256"
+
+// LoadSigningKey builds the signing key for the configured algorithm: HS256 uses the shared secret,
+// while RS256, ES256 and EdDSA read a PEM encoded private key of the matching type from privateKeyFile.
+func LoadSigningKey(algorithm string, secret string, privateKeyFile string) (*SigningKey, error) {
+	if algorithm == jwt.SigningMethodHS256.Alg() {
+		return NewHMACSigningKey(LegacySigningKid, []byte(secret))
+	}
+
+	if privateKeyFile == "" {
+		return nil, fmt.Errorf("a private key file is required for %s", algorithm)
+	}
+
+	pemBytes, err := os.ReadFile(privateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := ParsePrivateKeyPEM(pemBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	signingKey, err := NewAsymmetricSigningKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if signingKey.Method.Alg() != algorithm {
+		return nil, fmt.Errorf("private key is for %s, but %s is configured", signingKey.Method.Alg(), algorithm)
+	}
+
+	return signingKey, nil
+}
+
+// NewHMACSigningKey creates an HS256 key from a shared secret.
+func NewHMACSigningKey(kid string, secret []byte) (*SigningKey, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("JWT secret must not be empty")
+	}
+
+	return &SigningKey{
+		Kid:       kid,
+		Method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}, nil
+}
+
+// NewAsymmetricSigningKey wraps an RSA, ECDSA or Ed25519 private key. The algorithm follows from the
+// key type (RS256, ES256/ES384/ES512 by curve, or EdDSA) and the kid is the key's JWK thumbprint.
+func NewAsymmetricSigningKey(privateKey crypto.Signer) (*SigningKey, error) {
+	var method jwt.SigningMethod
+
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 2048 {
+			return nil, errors.New("RSA signing keys must be at least 2048 bits")
+		}
+		method = jwt.SigningMethodRS256
+	case *ecdsa.PrivateKey:
+		switch key.Curve {
+		case elliptic.P256():
+			method = jwt.SigningMethodES256
+		case elliptic.P384():
+			method = jwt.SigningMethodES384
+		case elliptic.P521():
+			method = jwt.SigningMethodES512
+		default:
+			return nil, errors.New("unsupported elliptic curve")
+		}
+	case ed25519.PrivateKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+
+	signingKey := &SigningKey{
+		Method:    method,
+		signKey:   privateKey,
+		verifyKey: privateKey.Public(),
+	}
+
+	jwk, err := signingKey.publicJWK()
+	if err != nil {
+		return nil, err
+	}
+
+	kid, err := jwkThumbprint(jwk)
+	if err != nil {
+		return nil, err
+	}
+	signingKey.Kid = kid
+
+	return signingKey, nil
+}
+
+// ParsePrivateKeyPEM parses a PKCS#8, PKCS#1 (RSA) or SEC 1 (EC) PEM encoded private key.
+func ParsePrivateKeyPEM(pemBytes []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var (
+		key any
+		err error
+	)
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+
+	return signer, nil
+}
+
+// IsAsymmetric reports whether the key has a public part that can be published.
+func (k *SigningKey) IsAsymmetric() bool {
+	_, isHMAC := k.Method.(*jwt.SigningMethodHMAC)
+	return !isHMAC
+}
+
+// publicJWK returns the public part of an asymmetric key as a JWK.
+func (k *SigningKey) publicJWK() (JWK, error) {
+	jwk := JWK{Kid: k.Kid, Use: "sig", Alg: k.Method.Alg()}
+
+	switch key := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+	case *ecdsa.PublicKey:
+		ecdhKey, err := key.ECDH()
+		if err != nil {
+			return JWK{}, err
+		}
+		// Uncompressed point: 0x04 || X || Y
+		point := ecdhKey.Bytes()[1:]
+		size := len(point) / 2
+
+		jwk.Kty = "EC"
+		jwk.Crv = key.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(point[:size])
+		jwk.Y = base64.RawURLEncoding.EncodeToString(point[size:])
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(key)
+	default:
+		return JWK{}, errors.New("key has no public JWK representation")
+	}
+
+	return jwk, nil
+}
+
+// jwkThumbprint computes the RFC 7638 thumbprint of a JWK, hashing only its required members
+// in lexicographic order.
+func jwkThumbprint(jwk JWK) (string, error) {
+	var members any
+
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	default:
+		return "", fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+
+	encoded, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(encoded)
+	return base64.RawURLEncoding.EncodeToString(hash[:]), nil
+}
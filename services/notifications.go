@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"santiagotorres.me/user-service/mailer"
+	"santiagotorres.me/user-service/models"
+)
+
+// SendPasswordResetEmail sends the password reset link for the given token to the user.
+func SendPasswordResetEmail(ctx context.Context, m mailer.Mailer, user *models.User, resetToken string, resetURL string, expiresIn time.Duration) error {
+	link, err := linkWithToken(resetURL, resetToken)
+	if err != nil {
+		return err
+	}
+
+	message, err := mailer.Render("password_reset", user.Email, map[string]any{
+		"Name":             user.Name,
+		"Link":             link,
+		"ExpiresInMinutes": int(expiresIn.Minutes()),
+	})
+	if err != nil {
+		return err
+	}
+
+	return m.Send(ctx, message)
+}
+
+// SendEmailVerificationEmail sends the email address verification link for the given token to the user.
+func SendEmailVerificationEmail(ctx context.Context, m mailer.Mailer, user *models.User, verificationToken string, verificationURL string, expiresIn time.Duration) error {
+	link, err := linkWithToken(verificationURL, verificationToken)
+	if err != nil {
+		return err
+	}
+
+	message, err := mailer.Render("email_verification", user.Email, map[string]any{
+		"Name":           user.Name,
+		"Link":           link,
+		"ExpiresInHours": int(expiresIn.Hours()),
+	})
+	if err != nil {
+		return err
+	}
+
+	return m.Send(ctx, message)
+}
+
+// linkWithToken appends the token as a query parameter to a frontend URL.
+func linkWithToken(baseURL string, token string) (string, error) {
+	link, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return link.String(), nil
+}
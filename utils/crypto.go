@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
@@ -8,77 +9,335 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
+	"math/big"
+	"strconv"
+	"strings"
 
-	"golang.org/x/crypto/bcrypt"
+	"santiagotorres.me/user-service/kms"
 )
 
-// HashPassword hashes a plaintext password using bcrypt.
-func HashPassword(password string) (string, error) {
-	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(hashedBytes), err
-}
-
-// CheckPasswordHash compares a plaintext password with a bcrypt hash.
-func CheckPasswordHash(password, hashedPassword string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-	return err == nil
-}
-
 // HashSHA256 creates a SHA-256 hash of the input data.
 func HashSHA256(data string) string {
 	hash := sha256.Sum256([]byte(data))
 	return hex.EncodeToString(hash[:])
 }
 
+// GenerateRandomToken creates a URL safe random token with 256 bits of entropy.
+func GenerateRandomToken() (string, error) {
+	randomBytes := make([]byte, 32)
+
+	if _, err := io.ReadFull(rand.Reader, randomBytes); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
+
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// GenerateRecoveryCode creates a random MFA recovery code formatted as three groups of four characters.
+func GenerateRecoveryCode() (string, error) {
+	alphabetSize := big.NewInt(int64(len(recoveryCodeAlphabet)))
+
+	var code strings.Builder
+	for i := 0; i < 12; i++ {
+		if i > 0 && i%4 == 0 {
+			code.WriteByte('-')
+		}
+
+		index, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		code.WriteByte(recoveryCodeAlphabet[index.Int64()])
+	}
+
+	return code.String(), nil
+}
+
+// HashRecoveryCode hashes a recovery code ignoring case, dashes and whitespace.
+func HashRecoveryCode(code string) string {
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(code))
+
+	return HashSHA256(normalized)
+}
+
+// legacyKeyVersion is the key version of ciphertexts written before they carried a version prefix.
+const legacyKeyVersion = 1
+
+// envelopePrefix marks ciphertexts encrypted with a per-record data key wrapped by the KMS.
+const envelopePrefix = "env:"
+
+// EncryptorManager encrypts secrets with AES-GCM using a keyring of versioned keys.
+// Ciphertexts are prefixed with the version of the key that produced them ("v2:<base64>"),
+// new secrets are always encrypted with the newest key and any known version can be decrypted.
+//
+// When a KMS is configured new secrets use envelope encryption instead: each secret gets its own
+// data key, stored wrapped by the KMS next to the ciphertext ("env:<key id>:<wrapped key>:<ciphertext>").
+// The versioned keys are then only kept to decrypt secrets written before the KMS was enabled.
 type EncryptorManager struct {
-	gcm cipher.AEAD
+	keys           map[int]cipher.AEAD
+	currentVersion int
+	keyManager     kms.KMS
 }
 
+// NewEncryptorManager creates an encryptor with a single key, used as key version 1.
 func NewEncryptorManager(key []byte) (*EncryptorManager, error) {
+	return NewVersionedEncryptorManager(map[int][]byte{legacyKeyVersion: key})
+}
 
-	if len(key) != 32 {
-		return nil, errors.New("Encryption key must be 32 bytes")
+// NewVersionedEncryptorManager creates an encryptor from keys indexed by version. The highest version encrypts.
+func NewVersionedEncryptorManager(keys map[int][]byte) (*EncryptorManager, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one encryption key is required")
 	}
 
-	block, err := aes.NewCipher(key)
+	em := &EncryptorManager{keys: make(map[int]cipher.AEAD, len(keys))}
 
-	if err != nil {
+	if err := em.addKeys(keys); err != nil {
 		return nil, err
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	return em, nil
+}
+
+// NewEnvelopeEncryptorManager creates an encryptor that encrypts new secrets with data keys wrapped by
+// keyManager. legacyKeys may be empty, otherwise they are used to decrypt secrets in the versioned format.
+func NewEnvelopeEncryptorManager(keyManager kms.KMS, legacyKeys map[int][]byte) (*EncryptorManager, error) {
+	if keyManager == nil {
+		return nil, errors.New("a KMS is required for envelope encryption")
+	}
+
+	em := &EncryptorManager{keys: make(map[int]cipher.AEAD, len(legacyKeys)), keyManager: keyManager}
+
+	if err := em.addKeys(legacyKeys); err != nil {
+		return nil, err
+	}
+
+	return em, nil
+}
+
+func (em *EncryptorManager) addKeys(keys map[int][]byte) error {
+	for version, key := range keys {
+		if version < 1 {
+			return fmt.Errorf("encryption key version must be positive, got %d", version)
+		}
+
+		if len(key) != 32 {
+			return fmt.Errorf("Encryption key version %d must be 32 bytes", version)
+		}
+
+		gcm, err := newGCM(key)
+
+		if err != nil {
+			return err
+		}
+
+		em.keys[version] = gcm
+		em.currentVersion = max(em.currentVersion, version)
+	}
+
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &EncryptorManager{gcm: gcm}, nil
+	return cipher.NewGCM(block)
+}
+
+// CurrentKey describes the key new secrets are encrypted with.
+func (em *EncryptorManager) CurrentKey() string {
+	if em.keyManager != nil {
+		return fmt.Sprintf("KMS key %s", em.keyManager.KeyID())
+	}
+	return fmt.Sprintf("key version %d", em.currentVersion)
 }
 
 func (em *EncryptorManager) EncryptSecret(secret string) (string, error) {
-	nonce := make([]byte, em.gcm.NonceSize())
+	if em.keyManager != nil {
+		return em.encryptEnvelope(secret)
+	}
 
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+	cipherText, err := seal(em.keys[em.currentVersion], []byte(secret))
+
+	if err != nil {
 		return "", err
 	}
 
-	cipherText := em.gcm.Seal(nonce, nonce, []byte(secret), nil)
-	return base64.StdEncoding.EncodeToString(cipherText), nil
+	return fmt.Sprintf("v%d:%s", em.currentVersion, base64.StdEncoding.EncodeToString(cipherText)), nil
 }
 
 func (em *EncryptorManager) DecryptSecret(encryptedText string) (string, error) {
-	cipherText, err := base64.StdEncoding.DecodeString(encryptedText)
+	if strings.HasPrefix(encryptedText, envelopePrefix) {
+		return em.decryptEnvelope(encryptedText)
+	}
+
+	version, encodedText := splitKeyVersion(encryptedText)
+
+	gcm, ok := em.keys[version]
+	if !ok {
+		return "", fmt.Errorf("unknown encryption key version %d", version)
+	}
+
+	cipherText, err := base64.StdEncoding.DecodeString(encodedText)
+
+	if err != nil {
+		return "", err
+	}
+
+	plainText, err := open(gcm, cipherText)
+	if err != nil {
+		return "", err
+	}
+	return string(plainText), nil
+}
+
+// NeedsReencryption reports whether the ciphertext was produced with a key older than the current one,
+// or, with a KMS configured, whether it is not wrapped by the current KMS key.
+func (em *EncryptorManager) NeedsReencryption(encryptedText string) bool {
+	if em.keyManager != nil {
+		keyID, _, _, err := splitEnvelope(encryptedText)
+		return err != nil || keyID != em.keyManager.KeyID()
+	}
+
+	if strings.HasPrefix(encryptedText, envelopePrefix) {
+		return true
+	}
+
+	version, _ := splitKeyVersion(encryptedText)
+	return version != em.currentVersion
+}
+
+func (em *EncryptorManager) encryptEnvelope(secret string) (string, error) {
+	dataKey := make([]byte, 32)
+
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(dataKey)
 
 	if err != nil {
 		return "", err
 	}
 
-	nonce, cipherText := cipherText[:em.gcm.NonceSize()], cipherText[em.gcm.NonceSize():]
+	cipherText, err := seal(gcm, []byte(secret))
 
-	plainText, err := em.gcm.Open(nil, nonce, cipherText, nil)
+	if err != nil {
+		return "", err
+	}
+
+	keyID := em.keyManager.KeyID()
+	wrappedKey, err := em.keyManager.WrapKey(context.Background(), dataKey)
+
+	if err != nil {
+		return "", fmt.Errorf("wrapping data key: %w", err)
+	}
+
+	return envelopePrefix + strings.Join([]string{
+		base64.RawURLEncoding.EncodeToString([]byte(keyID)),
+		base64.RawURLEncoding.EncodeToString(wrappedKey),
+		base64.RawURLEncoding.EncodeToString(cipherText),
+	}, ":"), nil
+}
+
+func (em *EncryptorManager) decryptEnvelope(encryptedText string) (string, error) {
+	if em.keyManager == nil {
+		return "", errors.New("secret is envelope encrypted but no KMS is configured")
+	}
+
+	keyID, wrappedKey, cipherText, err := splitEnvelope(encryptedText)
+
+	if err != nil {
+		return "", err
+	}
+
+	dataKey, err := em.keyManager.UnwrapKey(context.Background(), keyID, wrappedKey)
+
+	if err != nil {
+		return "", fmt.Errorf("unwrapping data key: %w", err)
+	}
+
+	gcm, err := newGCM(dataKey)
+
+	if err != nil {
+		return "", err
+	}
+
+	plainText, err := open(gcm, cipherText)
 	if err != nil {
 		return "", err
 	}
 	return string(plainText), nil
 }
+
+// splitEnvelope decodes the KMS key ID, wrapped data key and ciphertext of an envelope encrypted secret.
+func splitEnvelope(encryptedText string) (string, []byte, []byte, error) {
+	encodedText, found := strings.CutPrefix(encryptedText, envelopePrefix)
+	if !found {
+		return "", nil, nil, errors.New("secret is not envelope encrypted")
+	}
+
+	parts := strings.Split(encodedText, ":")
+	if len(parts) != 3 {
+		return "", nil, nil, errors.New("malformed envelope ciphertext")
+	}
+
+	decoded := make([][]byte, len(parts))
+	for i, part := range parts {
+		value, err := base64.RawURLEncoding.DecodeString(part)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		decoded[i] = value
+	}
+
+	return string(decoded[0]), decoded[1], decoded[2], nil
+}
+
+func seal(gcm cipher.AEAD, plainText []byte) ([]byte, error) {
+	nonce := make([]byte, gcm.NonceSize())
+
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plainText, nil), nil
+}
+
+func open(gcm cipher.AEAD, cipherText []byte) ([]byte, error) {
+	if len(cipherText) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, cipherText := cipherText[:gcm.NonceSize()], cipherText[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, cipherText, nil)
+}
+
+// splitKeyVersion separates the key version prefix from a ciphertext. Unprefixed ciphertexts are legacy ones.
+func splitKeyVersion(encryptedText string) (int, string) {
+	prefix, encodedText, found := strings.Cut(encryptedText, ":")
+
+	if !found || !strings.HasPrefix(prefix, "v") {
+		return legacyKeyVersion, encryptedText
+	}
+
+	version, err := strconv.Atoi(prefix[1:])
+	if err != nil {
+		return legacyKeyVersion, encryptedText
+	}
+
+	return version, encodedText
+}
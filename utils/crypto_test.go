@@ -0,0 +1,208 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func testEncryptionKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+// legacyCiphertext encrypts the secret the way it was stored before ciphertexts carried a key version.
+func legacyCiphertext(t *testing.T, key []byte, secret string) string {
+	t.Helper()
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cipherText, err := seal(gcm, []byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(cipherText)
+}
+
+func TestSplitKeyVersion(t *testing.T) {
+	tests := []struct {
+		input       string
+		wantVersion int
+		wantText    string
+	}{
+		{input: "v1:abc=", wantVersion: 1, wantText: "abc="},
+		{input: "v2:abc=", wantVersion: 2, wantText: "abc="},
+		{input: "v10:abc=", wantVersion: 10, wantText: "abc="},
+		{input: "abc=", wantVersion: legacyKeyVersion, wantText: "abc="},
+		{input: "", wantVersion: legacyKeyVersion, wantText: ""},
+		{input: "v:abc=", wantVersion: legacyKeyVersion, wantText: "v:abc="},
+		{input: "vx:abc=", wantVersion: legacyKeyVersion, wantText: "vx:abc="},
+		{input: "x2:abc=", wantVersion: legacyKeyVersion, wantText: "x2:abc="},
+	}
+
+	for _, tt := range tests {
+		version, text := splitKeyVersion(tt.input)
+
+		if version != tt.wantVersion || text != tt.wantText {
+			t.Errorf("splitKeyVersion(%q) = %d, %q, want %d, %q", tt.input, version, text, tt.wantVersion, tt.wantText)
+		}
+	}
+}
+
+func TestVersionedRoundTrip(t *testing.T) {
+	encryptor, err := NewVersionedEncryptorManager(map[int][]byte{
+		1: testEncryptionKey(1),
+		2: testEncryptionKey(2),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := encryptor.EncryptSecret("totp secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(encrypted, "v2:") {
+		t.Errorf("secret was not encrypted with the newest key: %q", encrypted)
+	}
+
+	decrypted, err := encryptor.DecryptSecret(encrypted)
+	if err != nil || decrypted != "totp secret" {
+		t.Errorf("DecryptSecret = %q, %v, want %q", decrypted, err, "totp secret")
+	}
+
+	if encryptor.NeedsReencryption(encrypted) {
+		t.Error("secret encrypted with the newest key needs reencryption")
+	}
+}
+
+func TestDecryptAfterKeyRotation(t *testing.T) {
+	before, err := NewEncryptorManager(testEncryptionKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := before.EncryptSecret("totp secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := NewVersionedEncryptorManager(map[int][]byte{
+		1: testEncryptionKey(1),
+		2: testEncryptionKey(2),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decrypted, err := after.DecryptSecret(encrypted)
+	if err != nil || decrypted != "totp secret" {
+		t.Errorf("DecryptSecret = %q, %v, want %q", decrypted, err, "totp secret")
+	}
+
+	if !after.NeedsReencryption(encrypted) {
+		t.Error("secret encrypted with an older key does not need reencryption")
+	}
+}
+
+func TestDecryptLegacyCiphertext(t *testing.T) {
+	encrypted := legacyCiphertext(t, testEncryptionKey(1), "totp secret")
+
+	encryptor, err := NewVersionedEncryptorManager(map[int][]byte{
+		1: testEncryptionKey(1),
+		2: testEncryptionKey(2),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decrypted, err := encryptor.DecryptSecret(encrypted)
+	if err != nil || decrypted != "totp secret" {
+		t.Errorf("DecryptSecret(legacy) = %q, %v, want %q", decrypted, err, "totp secret")
+	}
+
+	if !encryptor.NeedsReencryption(encrypted) {
+		t.Error("legacy ciphertext does not need reencryption")
+	}
+
+	// Legacy ciphertexts are version 1, another key must not be tried
+	other, err := NewVersionedEncryptorManager(map[int][]byte{2: testEncryptionKey(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := other.DecryptSecret(encrypted); err == nil {
+		t.Error("legacy ciphertext decrypted without key version 1")
+	}
+}
+
+func TestDecryptErrors(t *testing.T) {
+	encryptor, err := NewVersionedEncryptorManager(map[int][]byte{
+		1: testEncryptionKey(1),
+		2: testEncryptionKey(2),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := encryptor.EncryptSecret("totp secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, encoded := splitKeyVersion(encrypted)
+	cipherText, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipherText[len(cipherText)-1] ^= 1
+	tampered := "v2:" + base64.StdEncoding.EncodeToString(cipherText)
+
+	tests := []struct {
+		name      string
+		encrypted string
+		wantErr   string
+	}{
+		{name: "unknown key version", encrypted: "v3:" + encoded, wantErr: "unknown encryption key version 3"},
+		{name: "wrong key version", encrypted: "v1:" + encoded},
+		{name: "tampered ciphertext", encrypted: tampered},
+		{name: "invalid base64", encrypted: "v2:!!!"},
+		{name: "too short", encrypted: "v2:" + base64.StdEncoding.EncodeToString([]byte("short")), wantErr: "ciphertext too short"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := encryptor.DecryptSecret(tt.encrypted)
+
+			if err == nil {
+				t.Fatalf("DecryptSecret(%q) returned no error", tt.encrypted)
+			}
+
+			if tt.wantErr != "" && err.Error() != tt.wantErr {
+				t.Errorf("DecryptSecret(%q) error = %q, want %q", tt.encrypted, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewVersionedEncryptorManagerRejectsInvalidKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		keys map[int][]byte
+	}{
+		{name: "no keys", keys: map[int][]byte{}},
+		{name: "short key", keys: map[int][]byte{1: []byte("short")}},
+		{name: "zero version", keys: map[int][]byte{0: testEncryptionKey(1)}},
+	}
+
+	for _, tt := range tests {
+		if _, err := NewVersionedEncryptorManager(tt.keys); err == nil {
+			t.Errorf("%s: NewVersionedEncryptorManager returned no error", tt.name)
+		}
+	}
+}
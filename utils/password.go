@@ -0,0 +1,218 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher hashes passwords into a self describing encoded string.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether the password matches the encoded hash and whether the hash
+	// should be replaced because it was produced with outdated parameters.
+	Verify(password string, encodedHash string) (match bool, needsRehash bool)
+}
+
+// Argon2Params are the argon2id cost parameters. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params follow the second recommended option of RFC 9106 with a lower memory cost
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Argon2idHasher produces PHC formatted argon2id hashes ("$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>").
+type Argon2idHasher struct {
+	params Argon2Params
+}
+
+func NewArgon2idHasher(params Argon2Params) (*Argon2idHasher, error) {
+	if params.Memory < 8*uint32(params.Parallelism) || params.Iterations < 1 || params.Parallelism < 1 {
+		return nil, fmt.Errorf("invalid argon2id parameters m=%d,t=%d,p=%d", params.Memory, params.Iterations, params.Parallelism)
+	}
+
+	if params.SaltLength < 16 || params.KeyLength < 16 {
+		return nil, errors.New("argon2id salt and key length must be at least 16 bytes")
+	}
+
+	return &Argon2idHasher{params: params}, nil
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.params.Memory,
+		h.params.Iterations,
+		h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2idHasher) Verify(password string, encodedHash string) (bool, bool) {
+	params, salt, key, err := decodeArgon2idHash(encodedHash)
+
+	if err != nil {
+		return false, false
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	if subtle.ConstantTimeCompare(candidate, key) != 1 {
+		return false, false
+	}
+
+	return true, params != h.params
+}
+
+func decodeArgon2idHash(encodedHash string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errors.New("not an argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, err
+	}
+
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, err
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, err
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	// argon2.IDKey panics on these
+	if params.Iterations < 1 || params.Parallelism < 1 || params.Memory < 8*uint32(params.Parallelism) {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters m=%d,t=%d,p=%d", params.Memory, params.Iterations, params.Parallelism)
+	}
+
+	// An empty key would match any password
+	if len(salt) == 0 || len(key) < 16 {
+		return params, nil, nil, errors.New("argon2id hash is truncated")
+	}
+
+	return params, salt, key, nil
+}
+
+// BcryptHasher verifies the bcrypt hashes stored before argon2id was introduced.
+type BcryptHasher struct {
+	cost int
+}
+
+func NewBcryptHasher(cost int) *BcryptHasher {
+	return &BcryptHasher{cost: cost}
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	return string(hashedBytes), err
+}
+
+func (h *BcryptHasher) Verify(password string, encodedHash string) (bool, bool) {
+	if err := bcrypt.CompareHashAndPassword([]byte(encodedHash), []byte(password)); err != nil {
+		return false, false
+	}
+
+	cost, err := bcrypt.Cost([]byte(encodedHash))
+	return true, err != nil || cost != h.cost
+}
+
+var (
+	passwordHasherMu sync.RWMutex
+	passwordHasher   PasswordHasher = &Argon2idHasher{params: DefaultArgon2Params}
+	legacyHasher     PasswordHasher = NewBcryptHasher(bcrypt.DefaultCost)
+)
+
+// SetPasswordHasher replaces the hasher new passwords are hashed with. Hashes produced by any other
+// hasher are reported as needing a rehash when verified.
+func SetPasswordHasher(hasher PasswordHasher) {
+	passwordHasherMu.Lock()
+	defer passwordHasherMu.Unlock()
+	passwordHasher = hasher
+}
+
+func currentPasswordHasher() PasswordHasher {
+	passwordHasherMu.RLock()
+	defer passwordHasherMu.RUnlock()
+	return passwordHasher
+}
+
+// HashPassword hashes a plaintext password with the configured hasher, argon2id by default.
+func HashPassword(password string) (string, error) {
+	return currentPasswordHasher().Hash(password)
+}
+
+// CheckPasswordHash compares a plaintext password with a stored argon2id or legacy bcrypt hash.
+func CheckPasswordHash(password, hashedPassword string) bool {
+	match, _ := VerifyPassword(password, hashedPassword)
+	return match
+}
+
+// VerifyPassword compares a plaintext password with a stored hash and reports whether the hash
+// should be replaced with one from HashPassword, either because it is a legacy bcrypt hash or
+// because it was produced with different parameters.
+func VerifyPassword(password, hashedPassword string) (match bool, needsRehash bool) {
+	hasher := currentPasswordHasher()
+
+	if strings.HasPrefix(hashedPassword, "$argon2id$") {
+		if argon2idHasher, ok := hasher.(*Argon2idHasher); ok {
+			return argon2idHasher.Verify(password, hashedPassword)
+		}
+
+		match, _ = (&Argon2idHasher{params: DefaultArgon2Params}).Verify(password, hashedPassword)
+		return match, match
+	}
+
+	if bcryptHasher, ok := hasher.(*BcryptHasher); ok {
+		return bcryptHasher.Verify(password, hashedPassword)
+	}
+
+	match, _ = legacyHasher.Verify(password, hashedPassword)
+	return match, match
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"santiagotorres.me/user-service/breach"
+)
+
+// Password policy violation codes, stable identifiers clients can translate
+const (
+	PasswordTooShort        = "too_short"
+	PasswordTooLong         = "too_long"
+	PasswordMissingLower    = "missing_lowercase"
+	PasswordMissingUpper    = "missing_uppercase"
+	PasswordMissingDigit    = "missing_digit"
+	PasswordMissingSymbol   = "missing_symbol"
+	PasswordHasPersonalInfo = "contains_personal_info"
+	PasswordBreached        = "breached"
+)
+
+// minPersonalInfoLength avoids rejecting passwords because they contain a very short name
+const minPersonalInfoLength = 3
+
+// PasswordViolation is a single rule of the password policy a password does not satisfy.
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicy describes the requirements every new password must satisfy.
+type PasswordPolicy struct {
+	// Lengths are counted in characters, not bytes
+	MinLength     int
+	MaxLength     int
+	RequireLower  bool
+	RequireUpper  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// Reject passwords containing the user's email, its local part or name
+	DisallowPersonalInfo bool
+	// Optional list of known compromised passwords to reject
+	BreachChecker breach.Checker
+}
+
+// Check returns every rule the password violates, or nil when it satisfies the policy.
+// personalInfo holds the user's email address and names. An error is only returned when the
+// breach list could not be read, the other rules are still checked.
+func (p *PasswordPolicy) Check(password string, personalInfo ...string) ([]PasswordViolation, error) {
+	var violations []PasswordViolation
+
+	length := utf8.RuneCountInString(password)
+
+	if length < p.MinLength {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooShort,
+			Message: fmt.Sprintf("must be at least %d characters long", p.MinLength),
+		})
+	}
+
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooLong,
+			Message: fmt.Sprintf("must be at most %d characters long", p.MaxLength),
+		})
+	}
+
+	var hasLower, hasUpper, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+
+	if p.RequireLower && !hasLower {
+		violations = append(violations, PasswordViolation{Code: PasswordMissingLower, Message: "must contain a lowercase letter"})
+	}
+
+	if p.RequireUpper && !hasUpper {
+		violations = append(violations, PasswordViolation{Code: PasswordMissingUpper, Message: "must contain an uppercase letter"})
+	}
+
+	if p.RequireDigit && !hasDigit {
+		violations = append(violations, PasswordViolation{Code: PasswordMissingDigit, Message: "must contain a digit"})
+	}
+
+	if p.RequireSymbol && !hasSymbol {
+		violations = append(violations, PasswordViolation{Code: PasswordMissingSymbol, Message: "must contain a symbol"})
+	}
+
+	if p.DisallowPersonalInfo && containsPersonalInfo(password, personalInfo) {
+		violations = append(violations, PasswordViolation{Code: PasswordHasPersonalInfo, Message: "must not contain your email address or name"})
+	}
+
+	if p.BreachChecker == nil {
+		return violations, nil
+	}
+
+	breached, err := p.BreachChecker.IsBreached(password)
+	if breached {
+		violations = append(violations, PasswordViolation{Code: PasswordBreached, Message: "has appeared in a data breach, choose a different password"})
+	}
+
+	return violations, err
+}
+
+func containsPersonalInfo(password string, personalInfo []string) bool {
+	lowerPassword := strings.ToLower(password)
+
+	for _, info := range personalInfo {
+		candidates := []string{info}
+
+		// Check the local part of email addresses and each part of multi word names on their own
+		if localPart, _, isEmail := strings.Cut(info, "@"); isEmail {
+			candidates = append(candidates, localPart)
+		} else {
+			candidates = append(candidates, strings.Fields(info)...)
+		}
+
+		for _, candidate := range candidates {
+			candidate = strings.ToLower(strings.TrimSpace(candidate))
+			if utf8.RuneCountInString(candidate) >= minPersonalInfoLength && strings.Contains(lowerPassword, candidate) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
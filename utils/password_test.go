@@ -0,0 +1,212 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2Params keep hashing fast in tests
+var testArgon2Params = Argon2Params{
+	Memory:      64,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func newTestArgon2idHasher(t *testing.T, params Argon2Params) *Argon2idHasher {
+	t.Helper()
+
+	hasher, err := NewArgon2idHasher(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hasher
+}
+
+// usePasswordHasher replaces the global hasher for the duration of the test.
+func usePasswordHasher(t *testing.T, hasher PasswordHasher) {
+	t.Helper()
+
+	previous := currentPasswordHasher()
+	SetPasswordHasher(hasher)
+	t.Cleanup(func() { SetPasswordHasher(previous) })
+}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	hasher := newTestArgon2idHasher(t, testArgon2Params)
+
+	hash, err := hasher.Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("hash %q is not in PHC format", hash)
+	}
+
+	params, salt, key, err := decodeArgon2idHash(hash)
+	if err != nil {
+		t.Fatalf("decoding %q: %v", hash, err)
+	}
+
+	if params != testArgon2Params || len(salt) != 16 || len(key) != 32 {
+		t.Errorf("decoded %+v with %d byte salt and %d byte key, want %+v", params, len(salt), len(key), testArgon2Params)
+	}
+
+	if match, needsRehash := hasher.Verify("correct horse battery staple", hash); !match || needsRehash {
+		t.Errorf("Verify(correct password) = %v, %v, want true, false", match, needsRehash)
+	}
+
+	if match, _ := hasher.Verify("wrong password", hash); match {
+		t.Error("Verify(wrong password) matched")
+	}
+
+	other, err := hasher.Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if other == hash {
+		t.Error("hashing the same password twice produced the same hash, salts are not random")
+	}
+}
+
+func TestArgon2idNeedsRehashOnParameterChange(t *testing.T) {
+	hash, err := newTestArgon2idHasher(t, testArgon2Params).Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stronger := testArgon2Params
+	stronger.Iterations = 2
+
+	if match, needsRehash := newTestArgon2idHasher(t, stronger).Verify("password", hash); !match || !needsRehash {
+		t.Errorf("Verify with changed parameters = %v, %v, want true, true", match, needsRehash)
+	}
+}
+
+func TestDecodeArgon2idHashMalformed(t *testing.T) {
+	valid, err := newTestArgon2idHasher(t, testArgon2Params).Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(valid, "$")
+	salt, key := parts[4], parts[5]
+
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{name: "empty", hash: ""},
+		{name: "prefix only", hash: "$argon2id$"},
+		{name: "other algorithm", hash: "$argon2i$v=19$m=64,t=1,p=1$" + salt + "$" + key},
+		{name: "missing key", hash: "$argon2id$v=19$m=64,t=1,p=1$" + salt},
+		{name: "empty key", hash: "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$"},
+		{name: "truncated key", hash: "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$" + key[:8]},
+		{name: "empty salt", hash: "$argon2id$v=19$m=64,t=1,p=1$$" + key},
+		{name: "extra segment", hash: valid + "$extra"},
+		{name: "unsupported version", hash: "$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + key},
+		{name: "non numeric version", hash: "$argon2id$v=x$m=64,t=1,p=1$" + salt + "$" + key},
+		{name: "missing parameters", hash: "$argon2id$v=19$m=64$" + salt + "$" + key},
+		{name: "zero parallelism", hash: "$argon2id$v=19$m=64,t=1,p=0$" + salt + "$" + key},
+		{name: "zero iterations", hash: "$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + key},
+		{name: "memory below minimum", hash: "$argon2id$v=19$m=1,t=1,p=1$" + salt + "$" + key},
+		{name: "invalid salt encoding", hash: "$argon2id$v=19$m=64,t=1,p=1$!!!!$" + key},
+		{name: "invalid key encoding", hash: "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$!!!!"},
+	}
+
+	hasher := newTestArgon2idHasher(t, testArgon2Params)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, _, err := decodeArgon2idHash(tt.hash); err == nil {
+				t.Errorf("decodeArgon2idHash(%q) returned no error", tt.hash)
+			}
+
+			if match, needsRehash := hasher.Verify("password", tt.hash); match || needsRehash {
+				t.Errorf("Verify(%q) = %v, %v, want false, false", tt.hash, match, needsRehash)
+			}
+		})
+	}
+}
+
+func TestVerifyPassword(t *testing.T) {
+	argon2idHasher := newTestArgon2idHasher(t, testArgon2Params)
+	usePasswordHasher(t, argon2idHasher)
+
+	argon2idHash, err := argon2idHasher.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bcryptHash, err := NewBcryptHasher(bcrypt.MinCost).Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		password        string
+		hash            string
+		wantMatch       bool
+		wantNeedsRehash bool
+	}{
+		{name: "argon2id", password: "password", hash: argon2idHash, wantMatch: true},
+		{name: "argon2id wrong password", password: "wrong", hash: argon2idHash},
+		{name: "legacy bcrypt", password: "password", hash: bcryptHash, wantMatch: true, wantNeedsRehash: true},
+		{name: "legacy bcrypt wrong password", password: "wrong", hash: bcryptHash},
+		{name: "truncated argon2id", password: "password", hash: argon2idHash[:len(argon2idHash)-20]},
+		{name: "truncated bcrypt", password: "password", hash: bcryptHash[:20]},
+		{name: "empty hash", password: "password", hash: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, needsRehash := VerifyPassword(tt.password, tt.hash)
+
+			if match != tt.wantMatch || needsRehash != tt.wantNeedsRehash {
+				t.Errorf("VerifyPassword = %v, %v, want %v, %v", match, needsRehash, tt.wantMatch, tt.wantNeedsRehash)
+			}
+
+			if CheckPasswordHash(tt.password, tt.hash) != tt.wantMatch {
+				t.Errorf("CheckPasswordHash disagrees with VerifyPassword")
+			}
+		})
+	}
+}
+
+func TestVerifyPasswordWithBcryptHasher(t *testing.T) {
+	usePasswordHasher(t, NewBcryptHasher(bcrypt.MinCost))
+
+	sameCost, err := NewBcryptHasher(bcrypt.MinCost).Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherCost, err := NewBcryptHasher(bcrypt.MinCost + 1).Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if match, needsRehash := VerifyPassword("password", sameCost); !match || needsRehash {
+		t.Errorf("VerifyPassword(same cost) = %v, %v, want true, false", match, needsRehash)
+	}
+
+	if match, needsRehash := VerifyPassword("password", otherCost); !match || !needsRehash {
+		t.Errorf("VerifyPassword(other cost) = %v, %v, want true, true", match, needsRehash)
+	}
+
+	argon2idHash, err := newTestArgon2idHasher(t, testArgon2Params).Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Switching back to bcrypt rehashes argon2id hashes
+	if match, needsRehash := VerifyPassword("password", argon2idHash); !match || !needsRehash {
+		t.Errorf("VerifyPassword(argon2id) = %v, %v, want true, true", match, needsRehash)
+	}
+}